@@ -0,0 +1,123 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+// erago-golden runs erago game package with scripted inputs and compares its output with
+// the expected transcript, so that content authors can lock down behavior of their scripts.
+//
+// Usage:
+//
+//	erago-golden [flags] -expect EXPECTED_FILE PACKAGE_DIR
+//
+// Segments matched by -ignore patterns, such as timestamps or random values, are treated as
+// equal. -update overwrites EXPECTED_FILE by the current output instead of comparing.
+// It exits with status 1 when the output differs or the engine fails.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mzki/erago-wasm/headless"
+)
+
+// patternsFlag is a repeatable flag of regular expressions.
+type patternsFlag []*regexp.Regexp
+
+func (p *patternsFlag) String() string {
+	ss := make([]string, 0, len(*p))
+	for _, re := range *p {
+		ss = append(ss, re.String())
+	}
+	return strings.Join(ss, ",")
+}
+
+func (p *patternsFlag) Set(s string) error {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+var (
+	scriptFile = flag.String("script", "", "Input script file. \"-\" reads stdin. Empty runs without inputs.")
+	expectFile = flag.String("expect", "", "Required; expected transcript file.")
+	ignoreFile = flag.String("ignore-file", "", "File of ignore patterns, one regular expression per line.")
+	update     = flag.Bool("update", false, "Overwrite expected transcript by the current output.")
+	lineCount  = flag.Int("lines", 0, "Line count of view. 0 keeps the engine default.")
+	lineWidth  = flag.Int("width", 0, "Line width of view. 0 keeps the engine default.")
+	timeout    = flag.Duration("timeout", 60*time.Second, "Time limit of the whole run. 0 means no limit.")
+	ignores    patternsFlag
+)
+
+func init() {
+	flag.Var(&ignores, "ignore", "Regular expression of segments to ignore on comparison. Can be repeated.")
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 || len(*expectFile) == 0 {
+		fmt.Fprintln(os.Stderr, "required -expect and PACKAGE_DIR argument")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	equal, err := run(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !equal {
+		fmt.Fprintln(os.Stderr, "FAIL: output differs from", *expectFile)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr, "PASS")
+}
+
+func run(baseDir string) (equal bool, err error) {
+	inputs, err := headless.ReadScriptFile(*scriptFile)
+	if err != nil {
+		return false, err
+	}
+	patterns := []*regexp.Regexp(ignores)
+	if *ignoreFile != "" {
+		f, err := os.Open(*ignoreFile)
+		if err != nil {
+			return false, err
+		}
+		filePatterns, err := headless.ParseIgnorePatterns(f)
+		f.Close()
+		if err != nil {
+			return false, err
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+
+	var out bytes.Buffer
+	if err := headless.Run(headless.Options{
+		BaseDir:   baseDir,
+		Inputs:    inputs,
+		Output:    &out,
+		LineCount: *lineCount,
+		LineWidth: *lineWidth,
+		Timeout:   *timeout,
+	}); err != nil {
+		return false, err
+	}
+
+	if *update {
+		return true, os.WriteFile(*expectFile, out.Bytes(), 0644)
+	}
+	expected, err := os.ReadFile(*expectFile)
+	if err != nil {
+		return false, err
+	}
+	diff := headless.CompareGolden(string(expected), out.String(), patterns)
+	fmt.Print(diff.String())
+	return diff.Equal(), nil
+}
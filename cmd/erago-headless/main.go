@@ -0,0 +1,74 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+// erago-headless runs erago game package without browser, for automated testing in CI.
+//
+// Usage:
+//
+//	erago-headless [flags] PACKAGE_DIR
+//
+// Inputs are read from the script file given by -script, see headless.ParseScript for its format.
+// Text of published paragraphs is written to stdout or the file given by -out.
+// It exits with non-zero status when the engine fails.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mzki/erago-wasm/headless"
+)
+
+var (
+	scriptFile = flag.String("script", "", "Input script file. \"-\" reads stdin. Empty runs without inputs.")
+	outFile    = flag.String("out", "", "Output file. Empty writes to stdout.")
+	lineCount  = flag.Int("lines", 0, "Line count of view. 0 keeps the engine default.")
+	lineWidth  = flag.Int("width", 0, "Line width of view. 0 keeps the engine default.")
+	timeout    = flag.Duration("timeout", 60*time.Second, "Time limit of the whole run. 0 means no limit.")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "required PACKAGE_DIR argument")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(baseDir string) (err error) {
+	inputs, err := headless.ReadScriptFile(*scriptFile)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = f
+	}
+
+	return headless.Run(headless.Options{
+		BaseDir:   baseDir,
+		Inputs:    inputs,
+		Output:    out,
+		LineCount: *lineCount,
+		LineWidth: *lineWidth,
+		Timeout:   *timeout,
+	})
+}
@@ -2,7 +2,10 @@ module github.com/mzki/erago-wasm
 
 go 1.23.2
 
-require github.com/mzki/erago v0.10.0
+require (
+	github.com/mzki/erago v0.10.0
+	golang.org/x/text v0.19.0
+)
 
 require (
 	dmitri.shuralyov.com/gpu/mtl v0.0.0-20221208032759-85de2813cf6b // indirect
@@ -22,5 +25,4 @@ require (
 	golang.org/x/image v0.21.0 // indirect
 	golang.org/x/mobile v0.0.0-20240520174638-fa72addaaa1b // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.19.0 // indirect
 )
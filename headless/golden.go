@@ -0,0 +1,293 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package headless
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ignoredPlaceholder replaces segments matched by ignore patterns before comparison.
+const ignoredPlaceholder = "<ignored>"
+
+// maxDiffLines and maxDiffEdits limit lines and edit distance which are diffed in detail.
+// Larger differences are reported as replacement of the whole differing range.
+// Time is O(maxDiffLines * maxDiffEdits) and the trace for backtracking keeps
+// about maxDiffEdits^2 ints, 8MB for 1000 edits.
+const (
+	maxDiffLines = 20000
+	maxDiffEdits = 1000
+)
+
+// ParseIgnorePatterns reads regular expressions, one per line. Empty lines and lines
+// starting with '#' are skipped.
+func ParseIgnorePatterns(r io.Reader) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo += 1
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("ignore pattern line %d: %w", lineNo, err)
+		}
+		patterns = append(patterns, re)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// GoldenDiff is result of CompareGolden.
+type GoldenDiff struct {
+	hunks []diffHunk
+}
+
+// Equal returns whether actual output matches expected one.
+func (d *GoldenDiff) Equal() bool { return len(d.hunks) == 0 }
+
+// String returns unified diff from expected to actual. It is empty when Equal.
+func (d *GoldenDiff) String() string {
+	if d.Equal() {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("--- expected\n+++ actual\n")
+	for _, h := range d.hunks {
+		h.writeTo(&sb)
+	}
+	return sb.String()
+}
+
+// CompareGolden compares expected and actual output line by line. Segments matched by
+// ignores, such as timestamps or random values, are treated as equal in both of them.
+func CompareGolden(expected, actual string, ignores []*regexp.Regexp) *GoldenDiff {
+	a, b := splitLines(expected), splitLines(actual)
+	normA, normB := normalizeLines(a, ignores), normalizeLines(b, ignores)
+	ops := diffLines(normA, normB)
+	return &GoldenDiff{hunks: buildHunks(ops, a, b, 3)}
+}
+
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func normalizeLines(lines []string, ignores []*regexp.Regexp) []string {
+	if len(ignores) == 0 {
+		return lines
+	}
+	normalized := make([]string, 0, len(lines))
+	for _, line := range lines {
+		for _, re := range ignores {
+			line = re.ReplaceAllLiteralString(line, ignoredPlaceholder)
+		}
+		normalized = append(normalized, line)
+	}
+	return normalized
+}
+
+type diffOpKind byte
+
+const (
+	diffEqual  diffOpKind = ' '
+	diffDelete diffOpKind = '-'
+	diffInsert diffOpKind = '+'
+)
+
+// diffOp is an edit of line. A and B are indices in expected and actual lines.
+type diffOp struct {
+	Kind diffOpKind
+	A, B int
+}
+
+// diffLines returns edit script from a to b by Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	// common prefix and suffix are trimmed to reduce work.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix += 1
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix += 1
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{Kind: diffEqual, A: i, B: i})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	for _, op := range myersDiff(midA, midB) {
+		op.A += prefix
+		op.B += prefix
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffOp{Kind: diffEqual, A: len(a) - suffix + i, B: len(b) - suffix + i})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n+m > maxDiffLines || n == 0 || m == 0 {
+		return replaceAll(n, m)
+	}
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] keeps v[offset-d-1 : offset+d+2] before step d, which is all backtracking at d reads.
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(n, m)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// backtrack from the end, then reverse.
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		tv := trace[d] // tv[k+d+1] is v[offset+k].
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && tv[k+d] < tv[k+d+2]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := tv[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			ops = append(ops, diffOp{Kind: diffEqual, A: x, B: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y -= 1
+				ops = append(ops, diffOp{Kind: diffInsert, A: x, B: y})
+			} else {
+				x -= 1
+				ops = append(ops, diffOp{Kind: diffDelete, A: x, B: y})
+			}
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func replaceAll(n, m int) []diffOp {
+	ops := make([]diffOp, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, diffOp{Kind: diffDelete, A: i, B: 0})
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, diffOp{Kind: diffInsert, A: n, B: j})
+	}
+	return ops
+}
+
+// diffHunk is a group of changes with surrounding context lines.
+type diffHunk struct {
+	startA, countA int
+	startB, countB int
+	lines          []string // prefixed by diffOpKind.
+}
+
+func (h *diffHunk) writeTo(sb *strings.Builder) {
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(h.startA, h.countA), hunkRange(h.startB, h.countB))
+	for _, line := range h.lines {
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+}
+
+// hunkRange formats 0-based start and count as unified diff does. Empty range refers
+// to the line before it, so it starts with 0 at the beginning of text.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// buildHunks groups ops into hunks with context lines. Lines are shown from original
+// texts a and b rather than normalized ones.
+func buildHunks(ops []diffOp, a, b []string, context int) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == diffEqual {
+			i += 1
+			continue
+		}
+		// extend the hunk while changes are within 2*context lines.
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != diffEqual {
+				end += 1
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].Kind == diffEqual {
+				next += 1
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = next
+		}
+
+		h := diffHunk{startA: ops[start].A, startB: ops[start].B}
+		for _, op := range ops[start:end] {
+			switch op.Kind {
+			case diffEqual:
+				h.lines = append(h.lines, " "+a[op.A])
+				h.countA, h.countB = h.countA+1, h.countB+1
+			case diffDelete:
+				h.lines = append(h.lines, "-"+a[op.A])
+				h.countA += 1
+			case diffInsert:
+				h.lines = append(h.lines, "+"+b[op.B])
+				h.countB += 1
+			}
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
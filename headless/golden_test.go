@@ -0,0 +1,172 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package headless
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCompareGolden(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		expected string
+		actual   string
+		ignores  []string
+		diff     string // empty when equal.
+	}{
+		{
+			name:     "equal",
+			expected: "a\nb\nc\n",
+			actual:   "a\nb\nc\n",
+		},
+		{
+			name:     "equal except line ending",
+			expected: "a\r\nb\r\n",
+			actual:   "a\nb",
+		},
+		{
+			name:     "both empty",
+			expected: "",
+			actual:   "",
+		},
+		{
+			name:     "empty expected",
+			expected: "",
+			actual:   "a\nb\n",
+			diff:     "--- expected\n+++ actual\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "empty actual",
+			expected: "a\nb\n",
+			actual:   "",
+			diff:     "--- expected\n+++ actual\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:     "changed line",
+			expected: "a\nb\nc\n",
+			actual:   "a\nx\nc\n",
+			diff:     "--- expected\n+++ actual\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name:     "inserted and deleted lines",
+			expected: "a\nb\nc\nd\n",
+			actual:   "a\nc\nd\ne\n",
+			diff:     "--- expected\n+++ actual\n@@ -1,4 +1,4 @@\n a\n-b\n c\n d\n+e\n",
+		},
+		{
+			name:     "separate hunks",
+			expected: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			actual:   "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			diff: "--- expected\n+++ actual\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n" +
+				"@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n",
+		},
+		{
+			name:     "ignored segment",
+			expected: "saved at 2024-01-01 10:00\nok\n",
+			actual:   "saved at 2026-10-19 11:30\nok\n",
+			ignores:  []string{`\d{4}-\d{2}-\d{2} \d{2}:\d{2}`},
+		},
+		{
+			name:     "ignored segment does not hide other difference",
+			expected: "roll 3 of 6\n",
+			actual:   "roll 5 of 8\n",
+			ignores:  []string{`roll \d`},
+			diff:     "--- expected\n+++ actual\n@@ -1,1 +1,1 @@\n-roll 3 of 6\n+roll 5 of 8\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var ignores []*regexp.Regexp
+			for _, pattern := range tc.ignores {
+				ignores = append(ignores, regexp.MustCompile(pattern))
+			}
+			diff := CompareGolden(tc.expected, tc.actual, ignores)
+			if got, want := diff.Equal(), tc.diff == ""; got != want {
+				t.Errorf("Equal() = %v, want %v", got, want)
+			}
+			if got := diff.String(); got != tc.diff {
+				t.Errorf("diff mismatch\ngot:\n%s\nwant:\n%s", got, tc.diff)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func(n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = fmt.Sprint(rng.Intn(4))
+		}
+		return lines
+	}
+	for i := 0; i < 200; i++ {
+		a, b := randomLines(rng.Intn(30)), randomLines(rng.Intn(30))
+		var gotA, gotB []string
+		for _, op := range diffLines(a, b) {
+			switch op.Kind {
+			case diffEqual:
+				gotA, gotB = append(gotA, a[op.A]), append(gotB, b[op.B])
+			case diffDelete:
+				gotA = append(gotA, a[op.A])
+			case diffInsert:
+				gotB = append(gotB, b[op.B])
+			}
+		}
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("diffLines(%q, %q) does not reproduce inputs: %q, %q", a, b, gotA, gotB)
+		}
+	}
+}
+
+func TestDiffLinesTooManyEdits(t *testing.T) {
+	n := maxDiffEdits/2 + 2 // 2*(n-1) edits are needed.
+	a, b := make([]string, n), make([]string, n)
+	for i := range a {
+		a[i], b[i] = fmt.Sprint("a", i), fmt.Sprint("b", i)
+	}
+	// keep a common line in the middle so that the detailed diff differs from replacing all.
+	a[n/2], b[n/2] = "same", "same"
+	ops := diffLines(a, b)
+	if len(ops) != 2*n {
+		t.Fatalf("len(ops) = %d, want %d", len(ops), 2*n)
+	}
+	for i, op := range ops {
+		want := diffDelete
+		if i >= n {
+			want = diffInsert
+		}
+		if op.Kind != want {
+			t.Fatalf("ops[%d].Kind = %v, want %v", i, op.Kind, want)
+		}
+	}
+}
+
+func TestParseIgnorePatterns(t *testing.T) {
+	patterns, err := ParseIgnorePatterns(strings.NewReader("# timestamps\r\n\\d+:\\d+\r\n\r\nseed=\\w+\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, re := range patterns {
+		got = append(got, re.String())
+	}
+	if want := []string{`\d+:\d+`, `seed=\w+`}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("patterns = %q, want %q", got, want)
+	}
+
+	_, err = ParseIgnorePatterns(strings.NewReader("ok\n# comment\n(unclosed\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected error at line 3, got %v", err)
+	}
+
+	patterns, err = ParseIgnorePatterns(strings.NewReader(""))
+	if err != nil || len(patterns) != 0 {
+		t.Errorf("empty input: patterns = %v, err = %v", patterns, err)
+	}
+}
@@ -0,0 +1,238 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+// Package headless runs erago game package without UI, feeding inputs from a script and
+// writing text of published paragraphs. It is intended for automated testing of games.
+//
+// The engine is a process global singleton, so only one Run can be executed at a time.
+package headless
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mzki/erago-wasm/paratext"
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+// ErrTimeout is returned by Run when the engine does not finish in Options.Timeout.
+var ErrTimeout = errors.New("engine did not finish in time")
+
+type Options struct {
+	// BaseDir is the directory of the game package.
+	BaseDir string
+	// Inputs are fed to the engine in order. The engine quits when inputs are exhausted.
+	Inputs []Input
+	// Output receives text of fixed paragraphs, each terminated by "\n".
+	Output io.Writer
+	// LineCount and LineWidth is the initial view size. Zero keeps the engine default.
+	LineCount int
+	LineWidth int
+	// Timeout limits time of the whole run. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Run runs the game package until the engine quits or inputs are exhausted.
+// It returns error when the engine fails to initialize or quits with error.
+func Run(opts Options) error {
+	absDir, err := filepath.Abs(opts.BaseDir)
+	if err != nil {
+		return err
+	}
+	messenger := newUiMessenger(opts.Output, opts.Inputs)
+	if err := model.Init(messenger, absDir, &model.InitOptions{
+		ImageFetchType:      model.ImageFetchNone,
+		MessageByteEncoding: model.MessageByteEncodingProtobuf,
+		FileSystem:          model.NewOSDirFileSystem(absDir),
+	}); err != nil {
+		return fmt.Errorf("init Error: %w", err)
+	}
+	if opts.LineCount > 0 && opts.LineWidth > 0 {
+		if err := model.SetViewSize(opts.LineCount, opts.LineWidth); err != nil {
+			model.Quit()
+			return err
+		}
+	}
+
+	var timeout <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	model.Main(messenger)
+
+	select {
+	case <-messenger.Done():
+		model.Quit()
+		if err := messenger.QuitError(); err != nil {
+			return fmt.Errorf("engine quit with error: %w", err)
+		}
+	case <-messenger.Finished():
+		// error on quit is expected since the engine is interrupted.
+		model.Quit()
+		if err := messenger.ScriptError(); err != nil {
+			return err
+		}
+	case <-timeout:
+		model.Quit()
+		return ErrTimeout
+	}
+	return messenger.WriteError()
+}
+
+var _ model.UI = &uiMessenger{}
+
+// uiMessenger writes text of paragraphs and feeds inputs on input request.
+type uiMessenger struct {
+	done       chan struct{}
+	finished   chan struct{} // closed when inputs are exhausted or quit is requested by script.
+	finishOnce sync.Once
+
+	mu        sync.Mutex
+	out       io.Writer
+	writeErr  error
+	inputs    []Input
+	next      int
+	quitErr   error
+	scriptErr error
+}
+
+func newUiMessenger(out io.Writer, inputs []Input) *uiMessenger {
+	return &uiMessenger{
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		out:      out,
+		inputs:   inputs,
+	}
+}
+
+func (ui *uiMessenger) OnPublishBytes(bs []byte) error {
+	text, err := paratext.Decode(bs, model.MessageByteEncodingProtobuf)
+	if err != nil {
+		return err
+	}
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if ui.writeErr == nil {
+		_, ui.writeErr = io.WriteString(ui.out, text+"\n")
+	}
+	return nil
+}
+
+// temporary paragraph is not written since it is replaced by the next one.
+func (ui *uiMessenger) OnPublishBytesTemporary(bs []byte) error { return nil }
+
+// removed paragraphs are kept in the output, which is a record of what the engine printed.
+func (ui *uiMessenger) OnRemove(nParagraph int) error { return nil }
+func (ui *uiMessenger) OnRemoveAll() error            { return nil }
+
+// it is called when mobile.app requires inputting
+// user's command.
+func (ui *uiMessenger) OnCommandRequested() {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	var inputs []Input
+	for ui.next < len(ui.inputs) {
+		input := ui.inputs[ui.next]
+		ui.next += 1
+		if input.Kind == InputQuit {
+			ui.finish()
+			return
+		}
+		inputs = append(inputs, input)
+		if input.Kind == InputCommand {
+			break
+		}
+	}
+	if len(inputs) == 0 || inputs[len(inputs)-1].Kind != InputCommand {
+		ui.finish()
+		return
+	}
+	// send in another goroutine since this is called from the engine.
+	goSend(func() {
+		for _, input := range inputs {
+			if err := sendInput(input); err != nil {
+				ui.mu.Lock()
+				ui.scriptErr = fmt.Errorf("script line %d: %w", input.Line, err)
+				ui.mu.Unlock()
+				ui.finish()
+				return
+			}
+		}
+	})
+}
+
+// it is called when mobile.app requires just input any command.
+// such input, typically waiting for key press, is answered automatically.
+func (ui *uiMessenger) OnInputRequested() {
+	goSend(func() { model.SendCommand("") })
+}
+
+// it is called when mobile.app no longer requires any input,
+// such as just-input and command.
+func (ui *uiMessenger) OnInputRequestClosed() {}
+
+func (ui *uiMessenger) NotifyQuit(err error) {
+	ui.mu.Lock()
+	ui.quitErr = err
+	ui.mu.Unlock()
+	// close should be last since it unblocks Run
+	close(ui.done)
+}
+
+func (ui *uiMessenger) finish() {
+	ui.finishOnce.Do(func() { close(ui.finished) })
+}
+
+func (ui *uiMessenger) Done() <-chan struct{} { return ui.done }
+
+func (ui *uiMessenger) Finished() <-chan struct{} { return ui.finished }
+
+func (ui *uiMessenger) QuitError() error {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	return ui.quitErr
+}
+
+func (ui *uiMessenger) ScriptError() error {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	return ui.scriptErr
+}
+
+func (ui *uiMessenger) WriteError() error {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if ui.writeErr != nil {
+		return fmt.Errorf("output write error: %w", ui.writeErr)
+	}
+	return nil
+}
+
+// goSend runs send in new goroutine. Sending may race with quitting the engine after
+// Run returns, in which case the model panics as not initialized. It is ignored here.
+func goSend(send func()) {
+	go func() {
+		defer func() { _ = recover() }()
+		send()
+	}()
+}
+
+func sendInput(input Input) error {
+	switch input.Kind {
+	case InputCommand:
+		model.SendCommand(input.Command)
+	case InputViewSize:
+		return model.SetViewSize(input.Values[0], input.Values[1])
+	case InputSkippingWait:
+		model.SendSkippingWait()
+	case InputStopSkippingWait:
+		model.SendStopSkippingWait()
+	}
+	return nil
+}
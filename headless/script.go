@@ -0,0 +1,120 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package headless
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InputKind is a kind of Input.
+type InputKind int
+
+const (
+	InputCommand InputKind = iota
+	InputViewSize
+	InputSkippingWait
+	InputStopSkippingWait
+	InputQuit
+)
+
+// Input is an input sent to the engine. Command is sent when the engine requests command,
+// and other kinds are applied just before the next command.
+type Input struct {
+	Kind    InputKind
+	Command string // for InputCommand.
+	Values  []int  // for InputViewSize, line count and line width.
+	Line    int    // line number in the script, for error messages.
+}
+
+// ParseScript parses input script. Each line is a command sent to the engine verbatim,
+// including empty line which sends empty command. Following lines are special:
+//
+//	# comment            ignored.
+//	!viewsize 25 80      set view size to 25 lines of 80 width.
+//	!skipwait            start skipping wait.
+//	!stopskipwait        stop skipping wait.
+//	!quit                quit the engine without consuming rest of the script.
+//
+// Command starting with '#', '!' or '\' can be written by escaping it with '\'.
+func ParseScript(r io.Reader) ([]Input, error) {
+	var inputs []Input
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo += 1
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "\\"):
+			inputs = append(inputs, Input{Kind: InputCommand, Command: line[1:], Line: lineNo})
+		case strings.HasPrefix(line, "!"):
+			input, err := parseDirective(line[1:])
+			if err != nil {
+				return nil, fmt.Errorf("script line %d: %w", lineNo, err)
+			}
+			input.Line = lineNo
+			inputs = append(inputs, input)
+		default:
+			inputs = append(inputs, Input{Kind: InputCommand, Command: line, Line: lineNo})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+func parseDirective(directive string) (Input, error) {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 {
+		return Input{}, fmt.Errorf("empty directive")
+	}
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "viewsize":
+		if len(args) != 2 {
+			return Input{}, fmt.Errorf("viewsize requires 2 arguments, line count and line width")
+		}
+		values := make([]int, 0, len(args))
+		for _, arg := range args {
+			v, err := strconv.Atoi(arg)
+			if err != nil || v <= 0 {
+				return Input{}, fmt.Errorf("viewsize: invalid number %q", arg)
+			}
+			values = append(values, v)
+		}
+		return Input{Kind: InputViewSize, Values: values}, nil
+	case "skipwait":
+		return Input{Kind: InputSkippingWait}, nil
+	case "stopskipwait":
+		return Input{Kind: InputStopSkippingWait}, nil
+	case "quit":
+		return Input{Kind: InputQuit}, nil
+	default:
+		return Input{}, fmt.Errorf("unknown directive %q", name)
+	}
+}
+
+// ReadScriptFile parses input script at path. "-" reads stdin and empty path returns no inputs.
+func ReadScriptFile(path string) ([]Input, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return ParseScript(os.Stdin)
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ParseScript(f)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 The erago-wasm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//@ts-check
+
+/*
+    EngineWorkerHost owns engine_worker.js on the page and detects hang of the engine.
+
+    Go runtime on wasm has no preemption, so that the engine stuck in infinite loop of game script
+    blocks the worker entirely and can not report it by itself. The host pings the worker while
+    the engine is running, and posts following engineStatus to onmessage as if the worker sent them.
+
+    ["appEngineUnresponsive", elapsedMs]  no pong from the worker for hangThresholdMs.
+    ["appEngineResponsive", true]         pong arrives again after appEngineUnresponsive.
+    ["appEngineForceTerminated", reason]  the worker is terminated by force_terminate.
+
+    Posting ["force_terminate", reason] terminates the worker, which also releases OPFS handles
+    held by the stuck runtime, and creates new one. Post ["run_engine_worker"] again to restart the app.
+    Other messages are passed through to the worker as is.
+*/
+class EngineWorkerHost {
+    /**
+     * @param {string | URL} workerURL URL of engine_worker.js.
+     * @param {{hangThresholdMs?: number, pingIntervalMs?: number}} [options]
+     *   hangThresholdMs is time without pong to be unresponsive, 10 seconds by default. Zero or negative disables detection.
+     *   pingIntervalMs is interval of ping, 1 second by default.
+     */
+    constructor(workerURL, options = {}) {
+        this.workerURL = workerURL;
+        this.hangThresholdMs = options.hangThresholdMs ?? 10 * 1000;
+        this.pingIntervalMs = options.pingIntervalMs ?? 1000;
+        /** @type {((ev: MessageEvent) => any) | null} */
+        this.onmessage = null;
+        /** @type {((ev: MessageEvent) => any) | null} */
+        this.onmessageerror = null;
+
+        this.lastPong = Date.now();
+        this.unresponsive = false;
+        /** @type {number | undefined} */
+        this.pingTimer = undefined;
+        this.worker = this.createWorker();
+    }
+
+    /**
+     * @param {any} message
+     * @param {Transferable[]} [transfer]
+     */
+    postMessage(message, transfer) {
+        if (message[0] == "force_terminate") {
+            this.forceTerminate(message[1] ?? "force_terminate");
+            return;
+        }
+        this.worker.postMessage(message, transfer ?? []);
+    }
+
+    /**
+     * forceTerminate terminates the worker regardless of its state, then creates new one.
+     * @param {string} reason is reported by appEngineForceTerminated.
+     */
+    forceTerminate(reason) {
+        this.setEngineRunning(false);
+        this.worker.terminate();
+        this.worker = this.createWorker();
+        console.log("engine worker is terminated by force:", reason);
+        this.dispatchStatus(["appEngineForceTerminated", reason]);
+    }
+
+    /** terminate terminates the worker and stops hang detection. The host can not be used after this. */
+    terminate() {
+        this.setEngineRunning(false);
+        this.worker.terminate();
+    }
+
+    createWorker() {
+        const worker = new Worker(this.workerURL);
+        worker.onmessage = (ev) => this.handleMessage(ev);
+        worker.onmessageerror = (ev) => this.onmessageerror?.(ev);
+        return worker;
+    }
+
+    /** @param {MessageEvent} ev */
+    handleMessage(ev) {
+        const data = ev.data;
+        if (data[0] == "workerPong") {
+            this.lastPong = Date.now();
+            if (this.unresponsive) {
+                this.unresponsive = false;
+                this.dispatchStatus(["appEngineResponsive", true]);
+            }
+            return;
+        }
+        if (data[0] == "engineStatus") {
+            switch (data[1][0]) {
+                case "appEngineInitOK":
+                    this.setEngineRunning(true);
+                    break;
+                case "appEngineQuit":
+                case "appShutdown":
+                case "appCrashed":
+                    this.setEngineRunning(false);
+                    break;
+            }
+        }
+        this.onmessage?.(ev);
+    }
+
+    // hang is checked only while the engine is running, since installing or exporting large package
+    // may block the worker for a while.
+    /** @param {boolean} running */
+    setEngineRunning(running) {
+        clearInterval(this.pingTimer);
+        this.pingTimer = undefined;
+        this.unresponsive = false;
+        if (!running || this.hangThresholdMs <= 0) {
+            return;
+        }
+        this.lastPong = Date.now();
+        this.pingTimer = setInterval(() => this.ping(), this.pingIntervalMs);
+    }
+
+    ping() {
+        const elapsed = Date.now() - this.lastPong;
+        if (!this.unresponsive && elapsed > this.hangThresholdMs) {
+            this.unresponsive = true;
+            this.dispatchStatus(["appEngineUnresponsive", elapsed]);
+        }
+        this.worker.postMessage(["ping_worker", Date.now()]);
+    }
+
+    /** @param {any[]} status */
+    dispatchStatus(status) {
+        this.onmessage?.(new MessageEvent("message", { data: ["engineStatus", status] }));
+    }
+}
@@ -11,6 +11,18 @@ if (!WebAssembly.instantiateStreaming) { // polyfill
     };
 }
 
+// keep recent stderr of Go runtime, which has panic message and stack traces when it crashed.
+const goStderrLimit = 64 * 1024;
+const goStderrDecoder = new TextDecoder("utf-8");
+var goStderr = "";
+const goWriteSync = globalThis.fs.writeSync;
+globalThis.fs.writeSync = function (fd, buf) {
+    if (fd == 2) {
+        goStderr = (goStderr + goStderrDecoder.decode(buf, { stream: true })).slice(-goStderrLimit);
+    }
+    return goWriteSync.call(this, fd, buf);
+};
+
 var go = new Go();
 let mod, inst;
 WebAssembly.instantiateStreaming(fetch("erago.wasm"), go.importObject).then((result) => {
@@ -20,11 +32,79 @@ WebAssembly.instantiateStreaming(fetch("erago.wasm"), go.importObject).then((res
     console.error(err);
 });
 
+var goRunning = false;
 async function runGoApp() {
+    // Go app loops engine lifetimes by itself. re-instantiate only after it exits by shutdown_app.
+    if (goRunning) {
+        return;
+    }
+    goRunning = true;
     //console.clear();
-    await go.run(inst);
+    let exitCode = 0;
+    go.exit = (code) => { exitCode = code; };
+    goStderr = "";
+    try {
+        await go.run(inst);
+    } catch (err) {
+        // wasm trap, such as stack overflow, is thrown instead of exiting.
+        await reportGoCrash(String(err));
+        return; // keep goRunning since the instance is broken.
+    }
+    if (exitCode != 0) {
+        // unrecovered panic, e.g. in goroutine of the engine itself, exits Go runtime.
+        await reportGoCrash("exit code: " + exitCode);
+        return; // keep goRunning since OPFS handles of the dead runtime are never released.
+    }
     go = new Go(); // reset instance
     inst = await WebAssembly.instantiate(mod, go.importObject); // reset instance
+    goRunning = false;
+}
+
+// reportGoCrash persists crash report in the same place and format as Go app does,
+// then notifies it. The owner of this worker should terminate and create the worker again.
+async function reportGoCrash(reason) {
+    const panicLine = goStderr.split("\n").find((line) => line.startsWith("panic: ") || line.startsWith("fatal error: "));
+    const report = {
+        where: "runtime",
+        panic: panicLine ?? reason,
+        stack: goStderr,
+        occurredAt: Date.now(),
+        paragraphs: [],
+    };
+    try {
+        await persistCrashReport(report);
+    } catch (err) {
+        console.error("failed to persist crash report", err);
+    }
+    self.postMessage(["engineCrash", report]);
+    self.postMessage(["engineStatus", ["appCrashed", reason]]);
+}
+
+async function persistCrashReport(report) {
+    let dir = await navigator.storage.getDirectory();
+    for (const name of ["erago-wasm", ".crash-reports"]) { // same as rootDir and crashReportDir of Go app.
+        dir = await dir.getDirectoryHandle(name, { create: true });
+    }
+    const fileName = "crash-" + String(report.occurredAt).padStart(16, "0") + ".json";
+    const fileHandle = await dir.getFileHandle(fileName, { create: true });
+    const content = JSON.stringify({
+        appName: "",
+        version: "",
+        commitHash: "",
+        occurredAt: new Date(report.occurredAt).toISOString(),
+        where: report.where,
+        panic: report.panic,
+        stack: report.stack,
+        paragraphs: [],
+    }, null, 2);
+    const accessHandle = await fileHandle.createSyncAccessHandle();
+    try {
+        accessHandle.truncate(0);
+        accessHandle.write(new TextEncoder().encode(content), { at: 0 });
+        accessHandle.flush();
+    } finally {
+        accessHandle.close();
+    }
 }
 
 self.addEventListener("message", (ev) => {
@@ -32,10 +112,19 @@ self.addEventListener("message", (ev) => {
     if (data[0] == "run_engine_worker") {
         runGoApp();
     }
+    if (data[0] == "ping_worker") {
+        // answered here rather than by Go app. While Go blocks this thread, e.g. by infinite loop
+        // in game script, no pong is sent, so that the owner of this worker can detect hang.
+        // see EngineWorkerHost in engine_host.js.
+        ev.stopImmediatePropagation();
+        self.postMessage(["workerPong", data[1]]);
+    }
 }, false);
 
 /*
-    Events published from Engine.
+    Events published from Engine, used when event batching is disabled by EngineOptions.
+    Otherwise engine posts "engineEventBatch" message directly.
+    ev.detail is [arg, seq].
 
 	EngineOnPublishBytes EngineCallbackID = iota
 	EngineOnPublishBytesTemporary
@@ -64,17 +153,17 @@ for (const entry of [
         if (entry[1] == "addParagraph") {
             self.addEventListener(entry[0], (ev) => {
                 let transferrables = [ev.detail[0].buffer]; // for zero copy, move sematics for large binary.
-                self.postMessage(["engineEvent", [entry[1], ev.detail[0]]], transferrables)
+                self.postMessage(["engineEvent", [entry[1], ev.detail[0], ev.detail[1]]], transferrables)
             })
         } else {
             self.addEventListener(entry[0], (ev) => {
-                self.postMessage(["engineEvent", [entry[1], ev.detail[0]]])
+                self.postMessage(["engineEvent", [entry[1], ev.detail[0], ev.detail[1]]])
             })
         }
     } else {
         // Use entry constant as postMessage arg 
         self.addEventListener(entry[0], (ev) => {
-            self.postMessage(["engineEvent", [entry[1], entry[2]]])
+            self.postMessage(["engineEvent", [entry[1], entry[2], ev.detail[1]]])
         })
     }
 }
@@ -82,7 +171,7 @@ for (const entry of [
 self.addEventListener("EngineNotifyQuit", (ev) => {
     // null(means no error) treated as empty string to be consitent with string type.
     let msg = (ev.detail[0]) ? ev.detail[0] : "";
-    self.postMessage(["engineEvent", ["notifyQuit", msg]]);
+    self.postMessage(["engineEvent", ["notifyQuit", msg, ev.detail[1]]]);
 })
 
 self.postMessage(["engine_worker loaded!"])
\ No newline at end of file
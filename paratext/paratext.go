@@ -0,0 +1,51 @@
+// Package paratext converts paragraphs published by erago engine into plain text.
+// It is shared by the wasm worker and the native headless runner.
+package paratext
+
+import (
+	"fmt"
+	"strings"
+
+	model "github.com/mzki/erago/mobile/model/v2"
+	"github.com/mzki/erago/view/exp/text/pubdata"
+)
+
+// Decode decodes paragraph bytes encoded by encoding, one of model.MessageByteEncoding*,
+// into plain text. Lines are separated by "\n" and images are shown as [image: source].
+// Unknown encoding is treated as JSON, same as the model does.
+func Decode(bs []byte, encoding int) (string, error) {
+	p := &pubdata.Paragraph{}
+	var err error
+	switch encoding {
+	case model.MessageByteEncodingProtobuf:
+		err = p.UnmarshalVT(bs)
+	default:
+		err = p.UnmarshalJSON(bs)
+	}
+	if err != nil {
+		return "", fmt.Errorf("paragraph decode error: %w", err)
+	}
+	return Text(p), nil
+}
+
+// Text returns plain text of p.
+func Text(p *pubdata.Paragraph) string {
+	lines := make([]string, 0, len(p.Lines))
+	for _, l := range p.Lines {
+		var sb strings.Builder
+		for _, b := range l.Boxes {
+			switch {
+			case b.GetTextData() != nil:
+				sb.WriteString(b.GetTextData().Text)
+			case b.GetTextButtonData() != nil:
+				sb.WriteString(b.GetTextButtonData().GetTextData().GetText())
+			case b.GetImageData() != nil:
+				sb.WriteString("[image: " + b.GetImageData().Source + "]")
+			case b.GetSpaceData() != nil:
+				sb.WriteString(strings.Repeat(" ", int(max(b.RuneWidth, 0))))
+			}
+		}
+		lines = append(lines, strings.TrimRight(sb.String(), " "))
+	}
+	return strings.Join(lines, "\n")
+}
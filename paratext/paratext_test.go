@@ -0,0 +1,85 @@
+package paratext
+
+import (
+	"encoding/json"
+	"testing"
+
+	model "github.com/mzki/erago/mobile/model/v2"
+	"github.com/mzki/erago/view/exp/text/pubdata"
+)
+
+func testParagraph() *pubdata.Paragraph {
+	text := func(s string) *pubdata.Box {
+		return &pubdata.Box{RuneWidth: int32(len(s)), Data: &pubdata.Box_TextData{TextData: &pubdata.TextData{Text: s}}}
+	}
+	return &pubdata.Paragraph{
+		Id: 1,
+		Lines: []*pubdata.Line{
+			{Boxes: []*pubdata.Box{
+				text("hello"),
+				{RuneWidth: 2, Data: &pubdata.Box_SpaceData{SpaceData: &pubdata.SpaceData{}}},
+				{RuneWidth: 3, Data: &pubdata.Box_TextButtonData{TextButtonData: &pubdata.TextButtonData{
+					TextData: &pubdata.TextData{Text: "[0]"},
+					Command:  "0",
+				}}},
+			}},
+			{Boxes: []*pubdata.Box{
+				{RuneWidth: 4, Data: &pubdata.Box_ImageData{ImageData: &pubdata.ImageData{Source: "img/a.png"}}},
+				{RuneWidth: 3, Data: &pubdata.Box_SpaceData{SpaceData: &pubdata.SpaceData{}}},
+			}},
+			{},
+			{Boxes: []*pubdata.Box{text("end")}},
+		},
+		Fixed: true,
+	}
+}
+
+const testParagraphText = "hello  [0]\n[image: img/a.png]\n\nend"
+
+func TestDecode(t *testing.T) {
+	p := testParagraph()
+	protoBytes, err := p.MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same as model encodes paragraph for MessageByteEncodingJson.
+	jsonBytes, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		bs       []byte
+		encoding int
+		wantErr  bool
+	}{
+		{name: "protobuf", bs: protoBytes, encoding: model.MessageByteEncodingProtobuf},
+		{name: "json", bs: jsonBytes, encoding: model.MessageByteEncodingJson},
+		{name: "unknown encoding falls back to json", bs: jsonBytes, encoding: 99},
+		{name: "broken json", bs: []byte("{"), encoding: model.MessageByteEncodingJson, wantErr: true},
+		{name: "broken protobuf", bs: []byte{0xff}, encoding: model.MessageByteEncodingProtobuf, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decode(tc.bs, tc.encoding)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != testParagraphText {
+				t.Errorf("Decode() = %q, want %q", got, testParagraphText)
+			}
+		})
+	}
+}
+
+func TestTextEmpty(t *testing.T) {
+	if got := Text(&pubdata.Paragraph{}); got != "" {
+		t.Errorf("Text() = %q, want empty", got)
+	}
+}
@@ -0,0 +1,175 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// ArchiveType is a format of archive detected by DetectArchiveType.
+type ArchiveType int
+
+const (
+	ArchiveUnknown ArchiveType = iota
+	ArchiveZip
+	ArchiveTar
+	ArchiveGzip
+)
+
+var ErrUnsupportedArchive = errors.New("unsupported archive format")
+
+// zip flag bit 11, Language encoding flag (EFS). File name is encoded by UTF-8.
+const zipFlagUTF8 = 0x800
+
+// DetectArchiveType detects archive type by magic bytes.
+func DetectArchiveType(bs []byte) ArchiveType {
+	switch {
+	case bytes.HasPrefix(bs, []byte("PK\x03\x04")), bytes.HasPrefix(bs, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(bs, []byte{0x1f, 0x8b}):
+		return ArchiveGzip
+	case len(bs) >= 262 && bytes.Equal(bs[257:262], []byte("ustar")):
+		return ArchiveTar
+	default:
+		return ArchiveUnknown
+	}
+}
+
+// NormalizePackageArchive converts archive bytes into zip archive which has only UTF-8 file names,
+// so that it can be extracted by model.InstallPackage.
+// Supported formats are zip, tar and tar.gz. File names which are not UTF-8 are decoded as Shift-JIS(CP932).
+// Zip archive having UTF-8 file names only is returned as is.
+// limits is used to stop decompression of tar.gz. The result should be checked by ArchiveLimits.CheckZip.
+func NormalizePackageArchive(bs []byte, limits ArchiveLimits) ([]byte, error) {
+	switch DetectArchiveType(bs) {
+	case ArchiveZip:
+		return normalizeZip(bs)
+	case ArchiveTar:
+		return tarToZip(bytes.NewReader(bs))
+	case ArchiveGzip:
+		gzReader, err := gzip.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		tarBs, err := io.ReadAll(limits.limitTarReader(gzReader))
+		if err != nil {
+			return nil, err
+		}
+		if DetectArchiveType(tarBs) != ArchiveTar {
+			return nil, fmt.Errorf("%w: gzip content is not tar", ErrUnsupportedArchive)
+		}
+		return tarToZip(bytes.NewReader(tarBs))
+	default:
+		return nil, ErrUnsupportedArchive
+	}
+}
+
+func normalizeZip(bs []byte) ([]byte, error) {
+	zReader, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		return nil, err
+	}
+	needConvert := false
+	for _, zf := range zReader.File {
+		if zf.NonUTF8 {
+			needConvert = true
+			break
+		}
+	}
+	if !needConvert {
+		return bs, nil
+	}
+
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	for _, zf := range zReader.File {
+		header := zf.FileHeader // copy
+		if header.NonUTF8 {
+			name, err := decodeLegacyFileName(header.Name)
+			if err != nil {
+				return nil, err
+			}
+			header.Name = name
+			header.NonUTF8 = false
+			header.Flags |= zipFlagUTF8
+		}
+		// copy raw to avoid recompression.
+		w, err := zWriter.CreateRaw(&header)
+		if err != nil {
+			return nil, err
+		}
+		r, err := zf.OpenRaw()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return nil, err
+		}
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func tarToZip(r io.Reader) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	tarReader := tar.NewReader(r)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue // directories, links and special files are not extracted.
+		}
+		name, err := decodeLegacyFileName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		name = strings.TrimPrefix(path.Clean(name), "./")
+		w, err := zWriter.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: header.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, tarReader); err != nil {
+			return nil, err
+		}
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeLegacyFileName returns name as is if it is valid UTF-8, otherwise decodes it as Shift-JIS(CP932).
+func decodeLegacyFileName(name string) (string, error) {
+	if utf8.ValidString(name) {
+		return name, nil
+	}
+	decoded, err := japanese.ShiftJIS.NewDecoder().String(name)
+	if err != nil {
+		return "", fmt.Errorf("file name %q is neither UTF-8 nor Shift-JIS: %w", name, err)
+	}
+	return decoded, nil
+}
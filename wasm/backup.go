@@ -0,0 +1,425 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BackupManifestFile is the file name of manifest stored at the root of backup archive.
+const BackupManifestFile = "erago-wasm-backup.json"
+
+// BackupManifest describes contents of backup archive created by ExportAll.
+type BackupManifest struct {
+	AppName    string            `json:"appName"`
+	Version    string            `json:"version"`
+	CommitHash string            `json:"commitHash"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Packages   []string          `json:"packages"`
+	Files      []BackupFileEntry `json:"files"`
+}
+
+// BackupFileEntry is a file record in BackupManifest. Path is slash separated and relative to the root directory.
+type BackupFileEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// ConflictPolicy indicates how to resolve existing package on import.
+type ConflictPolicy int
+
+const (
+	ConflictSkip ConflictPolicy = iota
+	ConflictOverwrite
+	ConflictRename
+)
+
+var ErrUnknownConflictPolicy = errors.New("unknown conflict policy")
+
+// ParseConflictPolicy parses policy name, one of "skip", "overwrite" or "rename".
+// Empty name is treated as "skip".
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch name {
+	case "", "skip":
+		return ConflictSkip, nil
+	case "overwrite":
+		return ConflictOverwrite, nil
+	case "rename":
+		return ConflictRename, nil
+	default:
+		return ConflictSkip, fmt.Errorf("%w: %s", ErrUnknownConflictPolicy, name)
+	}
+}
+
+const (
+	importStagingDir = ".import-staging"
+	importBackupDir  = ".import-backup"
+)
+
+var (
+	ErrBackupNoManifest       = errors.New("backup manifest not found")
+	ErrBackupChecksumMismatch = errors.New("backup checksum mismatch")
+	ErrBackupInvalidPath      = errors.New("backup contains invalid path")
+)
+
+// ExportAll archives packages under fsys into zip bytes with BackupManifest.
+// packages are directories relative to fsys or absolute paths under fsys. Empty packages means
+// all directories directly under fsys. Hidden directories at any depth are not archived.
+func ExportAll(fsys *WebFileSystem, packages []string) ([]byte, error) {
+	if len(packages) == 0 {
+		entries, err := fsys.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// hidden directories are not packages but internal data, such as crash reports.
+			if entry.IsDir && !strings.HasPrefix(entry.Name, ".") {
+				packages = append(packages, entry.Name)
+			}
+		}
+	}
+
+	manifest := BackupManifest{
+		AppName:    APPNAME,
+		Version:    VERSION,
+		CommitHash: COMMIT_HASH,
+		CreatedAt:  time.Now(),
+		Packages:   make([]string, 0, len(packages)),
+		Files:      make([]BackupFileEntry, 0, 16),
+	}
+
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	for _, pkg := range packages {
+		pkg, err := backupRelPath(fsys, pkg)
+		if err != nil {
+			return nil, err
+		}
+		if !fsys.ExistDir(pkg) {
+			return nil, fmt.Errorf("package directory not found: %s", pkg)
+		}
+		files, err := fsys.WalkFiles(pkg)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if inHiddenDir(pkg, file) {
+				continue
+			}
+			entry, err := addBackupFile(zWriter, fsys, file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to archive %s: %w", file, err)
+			}
+			manifest.Files = append(manifest.Files, entry)
+		}
+		manifest.Packages = append(manifest.Packages, filepath.ToSlash(pkg))
+	}
+
+	manifestBs, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	w, err := zWriter.Create(BackupManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(manifestBs); err != nil {
+		return nil, err
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inHiddenDir returns whether file is under a hidden directory inside pkg, such as staging
+// directories of upgrade or runtime data directories, which are not a part of package.
+func inHiddenDir(pkg, file string) bool {
+	rel, err := filepath.Rel(pkg, file)
+	if err != nil {
+		return false
+	}
+	dirs := strings.Split(filepath.Dir(rel), string(filepath.Separator))
+	return slices.ContainsFunc(dirs, func(dir string) bool {
+		return strings.HasPrefix(dir, ".") && dir != "." && dir != ".."
+	})
+}
+
+func addBackupFile(zWriter *zip.Writer, fsys *WebFileSystem, file string) (BackupFileEntry, error) {
+	finfo, err := fsys.Stat(file)
+	if err != nil {
+		return BackupFileEntry{}, err
+	}
+	content, err := readAllFile(fsys, file)
+	if err != nil {
+		return BackupFileEntry{}, err
+	}
+	entry := BackupFileEntry{
+		Path:    filepath.ToSlash(file),
+		Size:    int64(len(content)),
+		SHA256:  sha256Hex(content),
+		ModTime: finfo.ModTime(),
+	}
+	w, err := zWriter.CreateHeader(&zip.FileHeader{
+		Name:     entry.Path,
+		Method:   zip.Deflate,
+		Modified: entry.ModTime,
+	})
+	if err != nil {
+		return BackupFileEntry{}, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return BackupFileEntry{}, err
+	}
+	return entry, nil
+}
+
+// RestoredPackage is a result of ImportAll for each package in backup archive.
+type RestoredPackage struct {
+	Package    string
+	RestoredTo string // empty when skipped
+	Skipped    bool
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r RestoredPackage) ToJsValue() map[string]any {
+	return map[string]any{
+		"package":    r.Package,
+		"restoredTo": r.RestoredTo,
+		"skipped":    r.Skipped,
+	}
+}
+
+// ImportAll restores packages in backup archive created by ExportAll into fsys.
+// All of checksums are verified before writing any files. Existing packages are resolved by policy.
+// Overwritten package is replaced only after the new one is extracted completely.
+func ImportAll(fsys *WebFileSystem, zipBytes []byte, policy ConflictPolicy) ([]RestoredPackage, error) {
+	zReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readBackupManifest(zReader)
+	if err != nil {
+		return nil, err
+	}
+	zFiles, err := verifyBackupFiles(zReader, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RestoredPackage, 0, len(manifest.Packages))
+	for _, pkg := range manifest.Packages {
+		result := RestoredPackage{Package: pkg, RestoredTo: pkg}
+		if fsys.ExistDir(filepath.FromSlash(pkg)) {
+			switch policy {
+			case ConflictSkip:
+				result.RestoredTo = ""
+				result.Skipped = true
+				results = append(results, result)
+				continue
+			case ConflictOverwrite:
+				// replaced after extraction succeeded.
+			case ConflictRename:
+				result.RestoredTo = renamedPackagePath(fsys, pkg)
+			}
+		}
+		if err := restoreBackupPackage(fsys, zFiles, manifest, pkg, result.RestoredTo); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// restoreBackupPackage extracts files of pkg into a staging directory and then moves it to dstPkg,
+// so that existing package at dstPkg is kept as is when extraction failed.
+func restoreBackupPackage(fsys *WebFileSystem, zFiles map[string]*zip.File, manifest *BackupManifest, pkg, dstPkg string) error {
+	dstDir := filepath.FromSlash(dstPkg)
+	stagingDir := filepath.Join(filepath.Dir(dstDir), importStagingDir)
+	backupDir := filepath.Join(filepath.Dir(dstDir), importBackupDir)
+	// remove leftovers from crashed import.
+	for _, dir := range []string{stagingDir, backupDir} {
+		if fsys.ExistDir(dir) {
+			if err := fsys.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := fsys.Sub(stagingDir, true); err != nil {
+		return err
+	}
+	defer func() {
+		if fsys.ExistDir(stagingDir) {
+			fsys.Remove(stagingDir)
+		}
+	}()
+
+	for _, entry := range manifest.Files {
+		rel, ok := cutPackagePrefix(entry.Path, pkg)
+		if !ok {
+			continue
+		}
+		dst := filepath.Join(stagingDir, filepath.FromSlash(rel))
+		if err := extractBackupFile(fsys, zFiles[entry.Path], dst); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+		}
+	}
+	return replaceDir(fsys, stagingDir, dstDir, backupDir)
+}
+
+func readBackupManifest(zReader *zip.Reader) (*BackupManifest, error) {
+	for _, zf := range zReader.File {
+		if zf.Name != BackupManifestFile {
+			continue
+		}
+		r, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		manifest := &BackupManifest{}
+		if err := json.NewDecoder(r).Decode(manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", BackupManifestFile, err)
+		}
+		return manifest, nil
+	}
+	return nil, ErrBackupNoManifest
+}
+
+// verifyBackupFiles checks every file in manifest exists in zip with same checksum.
+// It returns zip file entries indexed by path.
+func verifyBackupFiles(zReader *zip.Reader, manifest *BackupManifest) (map[string]*zip.File, error) {
+	zFiles := make(map[string]*zip.File, len(zReader.File))
+	for _, zf := range zReader.File {
+		zFiles[zf.Name] = zf
+	}
+	for _, pkg := range manifest.Packages {
+		if !filepath.IsLocal(filepath.FromSlash(pkg)) {
+			return nil, fmt.Errorf("%w: %s", ErrBackupInvalidPath, pkg)
+		}
+	}
+	for _, entry := range manifest.Files {
+		if !filepath.IsLocal(filepath.FromSlash(entry.Path)) {
+			return nil, fmt.Errorf("%w: %s", ErrBackupInvalidPath, entry.Path)
+		}
+		zf, ok := zFiles[entry.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrBackupChecksumMismatch, entry.Path)
+		}
+		content, err := readAllZipFile(zf)
+		if err != nil {
+			return nil, err
+		}
+		if sha256Hex(content) != entry.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrBackupChecksumMismatch, entry.Path)
+		}
+	}
+	return zFiles, nil
+}
+
+func extractBackupFile(fsys *WebFileSystem, zf *zip.File, dst string) error {
+	content, err := readAllZipFile(zf)
+	if err != nil {
+		return err
+	}
+	return writeAllFile(fsys, dst, content)
+}
+
+func renamedPackagePath(fsys *WebFileSystem, pkg string) string {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", pkg, i)
+		if !fsys.ExistDir(filepath.FromSlash(candidate)) {
+			return candidate
+		}
+	}
+}
+
+func cutPackagePrefix(path, pkg string) (rest string, ok bool) {
+	return strings.CutPrefix(path, pkg+"/")
+}
+
+func backupRelPath(fsys *WebFileSystem, path string) (string, error) {
+	rel, err := fsys.relPath(path)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.Clean(rel)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %s", ErrBackupInvalidPath, path)
+	}
+	return rel, nil
+}
+
+// ========== utils =============
+
+// replaceDir moves srcDir to dstDir. Existing dstDir is moved to backupDir beforehand and moved back
+// when moving srcDir failed, so that dstDir holds either the old or the new tree, never mixed of them.
+func replaceDir(fsys *WebFileSystem, srcDir, dstDir, backupDir string) error {
+	if !fsys.ExistDir(dstDir) {
+		return fsys.RenameDir(srcDir, dstDir)
+	}
+	if err := fsys.RenameDir(dstDir, backupDir); err != nil {
+		return err
+	}
+	if err := fsys.RenameDir(srcDir, dstDir); err != nil {
+		if rollbackErr := fsys.RenameDir(backupDir, dstDir); rollbackErr != nil {
+			// keep backup for manual recovery.
+			return errors.Join(err, fmt.Errorf("rollback failed, old tree is kept at %s: %w", backupDir, rollbackErr))
+		}
+		return err
+	}
+	if err := fsys.Remove(backupDir); err != nil {
+		// replacing is already done. the leftover is removed on next time.
+		fmt.Printf("failed to remove %s: %v\n", backupDir, err)
+	}
+	return nil
+}
+
+func readAllFile(fsys *WebFileSystem, fpath string) ([]byte, error) {
+	r, err := fsys.Load(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func writeAllFile(fsys *WebFileSystem, fpath string, content []byte) (err error) {
+	w, err := fsys.Store(fpath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, w.Close())
+	}()
+	_, err = w.Write(content)
+	return
+}
+
+func readAllZipFile(zf *zip.File) ([]byte, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
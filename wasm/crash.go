@@ -0,0 +1,187 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// crashReportDir stores crash reports under the app root directory.
+	crashReportDir = ".crash-reports"
+	// crashReportParagraphs is the number of last published paragraphs included in crash report.
+	crashReportParagraphs = 20
+)
+
+// CrashReport is information of recovered panic.
+type CrashReport struct {
+	AppName    string    `json:"appName"`
+	Version    string    `json:"version"`
+	CommitHash string    `json:"commitHash"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Where      string    `json:"where"` // method name or component where panic occurred.
+	Panic      string    `json:"panic"`
+	Stack      string    `json:"stack"`
+	// Paragraphs are last published paragraphs encoded by EngineOptions.MessageByteEncoding.
+	Paragraphs [][]byte `json:"paragraphs"`
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *CrashReport) ToJsValue() map[string]any {
+	paragraphs := make([]any, 0, len(r.Paragraphs))
+	for _, p := range r.Paragraphs {
+		paragraphs = append(paragraphs, ToJsBytes(p))
+	}
+	return map[string]any{
+		"where":      r.Where,
+		"panic":      r.Panic,
+		"stack":      r.Stack,
+		"occurredAt": r.OccurredAt.UnixMilli(),
+		"paragraphs": paragraphs,
+	}
+}
+
+// crashReporter keeps recent paragraphs and writes crash reports into fsys.
+type crashReporter struct {
+	mu         sync.Mutex
+	fsys       *WebFileSystem
+	paragraphs [][]byte
+}
+
+var theCrashReporter = &crashReporter{}
+
+// SetupCrashReporter sets filesystem to persist crash reports.
+func SetupCrashReporter(fsys *WebFileSystem) {
+	theCrashReporter.mu.Lock()
+	defer theCrashReporter.mu.Unlock()
+	theCrashReporter.fsys = fsys
+}
+
+// RecordParagraph keeps paragraph for crash report. Only last crashReportParagraphs are kept.
+func (c *crashReporter) RecordParagraph(bs []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.paragraphs) >= crashReportParagraphs {
+		c.paragraphs = c.paragraphs[1:]
+	}
+	c.paragraphs = append(c.paragraphs, bytes.Clone(bs))
+}
+
+// ClearParagraphs discards recorded paragraphs, e.g. when the engine is restarted.
+func (c *crashReporter) ClearParagraphs() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paragraphs = nil
+}
+
+func (c *crashReporter) newReport(where string, panicValue any, stack []byte) *CrashReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &CrashReport{
+		AppName:    APPNAME,
+		Version:    VERSION,
+		CommitHash: COMMIT_HASH,
+		OccurredAt: time.Now(),
+		Where:      where,
+		Panic:      fmt.Sprint(panicValue),
+		Stack:      string(stack),
+		Paragraphs: append([][]byte{}, c.paragraphs...),
+	}
+}
+
+func (c *crashReporter) persist(report *CrashReport) error {
+	c.mu.Lock()
+	fsys := c.fsys
+	c.mu.Unlock()
+	if fsys == nil {
+		return fmt.Errorf("crash reporter is not set up")
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("crash-%016d.json", report.OccurredAt.UnixMilli())
+	return writeAllFile(fsys, filepath.Join(crashReportDir, name), content)
+}
+
+// handlePanic reports recovered panic value to UI and persists it.
+// where is a method name or a component name. When it is a method name, the method is also
+// responded with error so that UI does not wait its result forever.
+func handlePanic(where string, panicValue any, isMethod bool) {
+	report := theCrashReporter.newReport(where, panicValue, debug.Stack())
+	fmt.Printf("panic in %s: %v\n%s", where, panicValue, report.Stack)
+	if err := theCrashReporter.persist(report); err != nil {
+		fmt.Printf("failed to persist crash report: %v\n", err)
+	}
+	SendBackEngineCrash(report)
+	if isMethod {
+		SendBackMethodError(where, fmt.Errorf("panic: %v", panicValue))
+	}
+}
+
+// GoRecover runs fn in new goroutine. Panic in fn is recovered and reported as crash of methodName.
+func GoRecover(methodName string, fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				handlePanic(methodName, r, true)
+			}
+		}()
+		fn()
+	}()
+}
+
+// RecoverCrash recovers panic and reports it as crash of where. It must be called by defer directly.
+func RecoverCrash(where string) {
+	if r := recover(); r != nil {
+		handlePanic(where, r, false)
+	}
+}
+
+// ExportCrashReports archives all crash reports into zip bytes.
+func ExportCrashReports(fsys *WebFileSystem) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	if fsys.ExistDir(crashReportDir) {
+		entries, err := fsys.ReadDir(crashReportDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir {
+				continue
+			}
+			content, err := readAllFile(fsys, filepath.Join(crashReportDir, entry.Name))
+			if err != nil {
+				return nil, err
+			}
+			w, err := zWriter.Create(entry.Name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ClearCrashReports removes all crash reports.
+func ClearCrashReports(fsys *WebFileSystem) error {
+	if !fsys.ExistDir(crashReportDir) {
+		return nil
+	}
+	return fsys.Remove(crashReportDir)
+}
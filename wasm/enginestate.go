@@ -0,0 +1,134 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"sync"
+	"syscall/js"
+)
+
+// EnginePhase is a lifecycle phase of the app.
+type EnginePhase string
+
+const (
+	PhaseWaitForEngineInit EnginePhase = "waitForEngineInit"
+	PhaseEngineInitialized EnginePhase = "engineInitialized" // waiting for start_engine.
+	PhaseEngineRunning     EnginePhase = "engineRunning"
+	PhaseShutdown          EnginePhase = "shutdown"
+)
+
+// InputRequest is a kind of input which the engine currently waits for.
+type InputRequest string
+
+const (
+	InputRequestNone    InputRequest = "none"
+	InputRequestCommand InputRequest = "command"
+	InputRequestInput   InputRequest = "input"
+)
+
+// engineState tracks current state of the app so that UI can query it at any time.
+type engineState struct {
+	mu           sync.Mutex
+	phase        EnginePhase
+	rootPath     string
+	options      *EngineOptions
+	inputRequest InputRequest
+	skippingWait bool // last requested by UI. engine may stop skipping by itself.
+	lineCount    int
+	lineWidth    int
+	textUnitW    float64
+	textUnitH    float64
+}
+
+var theEngineState = &engineState{phase: PhaseWaitForEngineInit, inputRequest: InputRequestNone}
+
+func (s *engineState) update(fn func(s *engineState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+func (s *engineState) SetPhase(phase EnginePhase) {
+	s.update(func(s *engineState) { s.phase = phase })
+}
+
+// SetEngine sets loaded package and options. It also resets states of previous engine.
+func (s *engineState) SetEngine(rootPath string, opt *EngineOptions) {
+	s.update(func(s *engineState) {
+		s.rootPath = rootPath
+		s.options = opt
+		s.inputRequest = InputRequestNone
+		s.skippingWait = false
+		s.lineCount, s.lineWidth = 0, 0
+		s.textUnitW, s.textUnitH = 0, 0
+	})
+}
+
+func (s *engineState) SetInputRequest(req InputRequest) {
+	s.update(func(s *engineState) { s.inputRequest = req })
+}
+
+func (s *engineState) InputRequest() InputRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inputRequest
+}
+
+func (s *engineState) SetSkippingWait(skipping bool) {
+	s.update(func(s *engineState) { s.skippingWait = skipping })
+}
+
+func (s *engineState) SetViewSize(lineCount, lineWidth int) {
+	s.update(func(s *engineState) { s.lineCount, s.lineWidth = lineCount, lineWidth })
+}
+
+func (s *engineState) SetTextUnitPx(w, h float64) {
+	s.update(func(s *engineState) { s.textUnitW, s.textUnitH = w, h })
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (s *engineState) ToJsValue() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var options any = nil
+	if s.options != nil {
+		options = s.options.ToJsValue()
+	}
+	return map[string]any{
+		"phase":        string(s.phase),
+		"rootPath":     s.rootPath,
+		"options":      options,
+		"inputRequest": string(s.inputRequest),
+		"skippingWait": s.skippingWait,
+		"viewSize": map[string]any{
+			"lineCount": s.lineCount,
+			"lineWidth": s.lineWidth,
+		},
+		"textUnitPx": map[string]any{
+			"width":  s.textUnitW,
+			"height": s.textUnitH,
+		},
+	}
+}
+
+// RunEngineStateQuery handles get_engine_state through all of the app lifetime.
+// It should be called before other method handlers to take precedence over RunNotImplemented.
+func RunEngineStateQuery() (cancelFunc func()) {
+	var callback js.Func
+	cancelFunc = func() {
+		js.Global().Get("self").Call("removeEventListener", "message", callback)
+		callback.Release()
+	}
+	callback = js.FuncOf(func(this js.Value, args []js.Value) any {
+		data := args[0].Get("data")
+		switch methodName := data.Index(0).String(); methodName {
+		case "get_engine_state":
+			ConsumeMessageEvent(args[0])
+			SendBackEngineState(methodName, theEngineState)
+		}
+		return nil
+	})
+	js.Global().Get("self").Call("addEventListener", "message", callback, false)
+	return
+}
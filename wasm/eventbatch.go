@@ -0,0 +1,111 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// DefaultEventBatchWindow is the default time window to batch engine events into one message.
+// Batching is disabled by default so that engine events are posted one by one as before.
+// UI which handles engineEventBatch opts in by options.eventBatchWindowMs, e.g. 16.
+const DefaultEventBatchWindow time.Duration = 0
+
+// engineEvent is an event sent to UI in engineEventBatch, as [Type, Arg, Seq].
+// Type and Arg are same as engineEvent message posted by engine_worker.js.
+type engineEvent struct {
+	Seq  uint64
+	Type string
+	Arg  any
+}
+
+// toEngineEvent converts callback event into engineEvent.
+func toEngineEvent(cbID EngineCallbackID, seq uint64, payload any) engineEvent {
+	ev := engineEvent{Seq: seq, Arg: payload}
+	switch cbID {
+	case EngineOnPublishBytes, EngineOnPublishBytesTemporary:
+		ev.Type = "addParagraph"
+	case EngineOnRemove:
+		ev.Type = "removeParagraph"
+	case EngineOnRemoveAll:
+		ev.Type, ev.Arg = "removeParagraph", -1
+	case EngineOnCommandRequested:
+		ev.Type, ev.Arg = "inputStatus", "commandRequested"
+	case EngineOnInputRequested:
+		ev.Type, ev.Arg = "inputStatus", "inputRequested"
+	case EngineOnInputRequestClosed:
+		ev.Type, ev.Arg = "inputStatus", "inputRequestClosed"
+	case EngineNotifyQuit:
+		ev.Type = "notifyQuit"
+		if payload == nil {
+			ev.Arg = "" // same as engine_worker.js
+		}
+	default:
+		ev.Type = cbID.String()
+	}
+	return ev
+}
+
+// eventBatcher collects engine events within the window and posts them as one engineEventBatch message.
+// Paragraph buffers are transferred to avoid copy.
+type eventBatcher struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []engineEvent
+	timer   *time.Timer
+}
+
+func newEventBatcher(window time.Duration) *eventBatcher {
+	return &eventBatcher{window: window}
+}
+
+// Add queues ev. The queue is flushed after the window from the first queued event,
+// or immediately when flushNow is true.
+func (b *eventBatcher) Add(ev engineEvent, flushNow bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, ev)
+	if flushNow {
+		b.flushLocked()
+	} else if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.Flush)
+	}
+}
+
+// Flush posts queued events now.
+func (b *eventBatcher) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+// flushLocked posts queued events. posting under the lock keeps the order of batches.
+func (b *eventBatcher) flushLocked() {
+	events := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	// events may be added from different goroutines. make sure the order.
+	slices.SortStableFunc(events, func(a, b engineEvent) int { return cmp.Compare(a.Seq, b.Seq) })
+	batch := make([]any, 0, len(events))
+	transfers := make([]any, 0, len(events))
+	for _, ev := range events {
+		batch = append(batch, []any{ev.Type, ev.Arg, ev.Seq})
+		if v, ok := ev.Arg.(js.Value); ok && v.InstanceOf(js.Global().Get("Uint8Array")) {
+			transfers = append(transfers, v.Get("buffer"))
+		}
+	}
+	postMessageTransfer("engineEventBatch", batch, transfers)
+}
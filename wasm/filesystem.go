@@ -9,9 +9,11 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall/js"
+	"time"
 
 	model "github.com/mzki/erago/mobile/model/v2"
 )
@@ -109,9 +111,22 @@ func (fsys *WebFileSystem) Store(fpath string) (model.WriteCloser, error) {
 	if err != nil {
 		return nil, &fs.PathError{Op: "open-write", Path: fpath, Err: err}
 	}
+	// discard old content like os.Create. Otherwise shorter content leaves old bytes at the tail.
+	syncWriter.Call("truncate", 0)
 	return newWebWriter(fpath, syncWriter), nil
 }
 
+// Append opens fpath to write after its current content. It creates the file if not exist.
+func (fsys *WebFileSystem) Append(fpath string) (model.WriteCloser, error) {
+	syncWriter, err := fsys.openSyncAccessHandle(fpath, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open-append", Path: fpath, Err: err}
+	}
+	w := newWebWriter(fpath, syncWriter)
+	w.writeCount = syncWriter.Call("getSize").Int()
+	return w, nil
+}
+
 func (fsys *WebFileSystem) Exist(fpath string) bool {
 	fpath, err := fsys.relPath(fpath)
 	if err != nil {
@@ -234,6 +249,156 @@ func (fsys *WebFileSystem) Remove(fpath string) error {
 	return nil
 }
 
+// RenameDir moves directory oldpath to newpath, which must not exist.
+// The directory is moved as a whole by FileSystemHandle.move, so that newpath never contains
+// partially moved tree. On browsers without move, it falls back to copying and removing oldpath.
+func (fsys *WebFileSystem) RenameDir(oldpath, newpath string) error {
+	oldpath, err := fsys.relPath(oldpath)
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: err}
+	}
+	newpath, err = fsys.relPath(newpath)
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: err}
+	}
+	if fsys.Exist(newpath) || fsys.ExistDir(newpath) {
+		return &fs.PathError{Op: "rename", Path: newpath, Err: fs.ErrExist}
+	}
+	dirHandle, jsErr := recursiveGetDirHandle(fsys.root, oldpath, JsOptions(map[string]any{"create": false}))
+	if !jsErr.IsNull() {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: jsErr}
+	}
+	if dirHandle.Get("move").Type() != js.TypeFunction {
+		if err := copyFiles(fsys, oldpath, newpath); err != nil {
+			return err
+		}
+		return fsys.Remove(oldpath)
+	}
+
+	parentHandle := fsys.root
+	if parent, _ := filepath.Split(newpath); parent != "" {
+		parentHandle, jsErr = recursiveGetDirHandle(fsys.root, filepath.Clean(parent), JsOptions(map[string]any{"create": true}))
+		if !jsErr.IsNull() {
+			return &fs.PathError{Op: "rename", Path: parent, Err: jsErr}
+		}
+	}
+	if _, jsErr := Await1(dirHandle.Call("move", parentHandle, filepath.Base(newpath))); !jsErr.IsNull() {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: jsErr}
+	}
+	return nil
+}
+
+// WebDirEntry is an entry of directory listed by ReadDir.
+type WebDirEntry struct {
+	Name  string
+	IsDir bool
+}
+
+// ReadDir lists entries directly under dir. Empty dir or "." means root of fsys.
+func (fsys *WebFileSystem) ReadDir(dir string) ([]WebDirEntry, error) {
+	dirFsys, err := fsys.subOrSelf(dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: err}
+	}
+	jsEntries, jsErr := dirFsys.jsDirEntries()
+	if !jsErr.IsNull() {
+		return nil, &fs.PathError{Op: "readdir-entries", Path: dirFsys.absRootPath, Err: jsErr}
+	}
+	entries := make([]WebDirEntry, 0, len(jsEntries))
+	for _, entry := range jsEntries {
+		entries = append(entries, WebDirEntry{
+			Name:  entry.Get("name").String(),
+			IsDir: entry.Get("kind").String() == "directory",
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// WalkFiles collects file paths under dir recursively. Empty dir or "." means root of fsys.
+// Returned paths are relative to fsys, not to dir.
+func (fsys *WebFileSystem) WalkFiles(dir string) ([]string, error) {
+	dir, err := fsys.relPath(dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "walk", Path: dir, Err: err}
+	}
+	return fsys.walkFiles(0, filepath.Clean(dir))
+}
+
+func (fsys *WebFileSystem) walkFiles(nFiles int, dir string) ([]string, error) {
+	// to avoid infinite file travasal, shares same limit with glob.
+	const maxFiles = 10000
+	if nFiles > maxFiles {
+		return nil, ErrTooManyFilesInGlobPatten
+	}
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		path := entry.Name
+		if dir != "." {
+			path = filepath.Join(dir, entry.Name)
+		}
+		if entry.IsDir {
+			subFiles, err := fsys.walkFiles(nFiles+len(files), path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, subFiles...)
+		} else {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Stat returns file information for fpath. Only regular file is supported.
+func (fsys *WebFileSystem) Stat(fpath string) (fs.FileInfo, error) {
+	relPath, err := fsys.relPath(fpath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: fpath, Err: err}
+	}
+	fileHandle, jsErr := recursiveGetFileHandle(fsys.root, relPath, JsOptions(map[string]any{"create": false}))
+	if !jsErr.IsNull() {
+		return nil, &fs.PathError{Op: "stat", Path: relPath, Err: jsErr}
+	}
+	file, jsErr := Await1(fileHandle.Call("getFile"))
+	if !jsErr.IsNull() {
+		return nil, &fs.PathError{Op: "stat-getfile", Path: relPath, Err: jsErr}
+	}
+	return &webFileInfo{
+		name:    filepath.Base(relPath),
+		size:    int64(file.Get("size").Float()),
+		modTime: time.UnixMilli(int64(file.Get("lastModified").Float())),
+	}, nil
+}
+
+func (fsys *WebFileSystem) subOrSelf(dir string) (*WebFileSystem, error) {
+	dir, err := fsys.relPath(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir = filepath.Clean(dir); dir == "." {
+		return fsys, nil
+	}
+	return fsys.Sub(dir, false)
+}
+
+type webFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *webFileInfo) Name() string       { return fi.name }
+func (fi *webFileInfo) Size() int64        { return fi.size }
+func (fi *webFileInfo) Mode() fs.FileMode  { return fs.ModePerm }
+func (fi *webFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *webFileInfo) IsDir() bool        { return false }
+func (fi *webFileInfo) Sys() any           { return nil }
+
 func recursiveGetFileHandle(root js.Value, relPath string, options js.Value) (ret js.Value, err js.Error) {
 	return recursiveGetXXXHandle("getFileHandle", root, relPath, options)
 }
@@ -0,0 +1,88 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"sync"
+)
+
+// flowControl limits bytes of paragraphs which are sent to UI but not acknowledged yet.
+// UI acknowledges consumed events by its sequence number through ack_events method.
+type flowControl struct {
+	limit int64 // zero or negative disables flow control.
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	outstanding []flowEntry
+	unacked     int64
+	closed      bool
+}
+
+type flowEntry struct {
+	seq  uint64
+	size int64
+}
+
+func newFlowControl(limit int64) *flowControl {
+	fc := &flowControl{limit: limit}
+	fc.cond = sync.NewCond(&fc.mu)
+	return fc
+}
+
+func (fc *flowControl) Enabled() bool { return fc.limit > 0 }
+
+// Track records size of the event seq sent to UI.
+func (fc *flowControl) Track(seq uint64, size int64) {
+	if !fc.Enabled() {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.outstanding = append(fc.outstanding, flowEntry{seq: seq, size: size})
+	fc.unacked += size
+}
+
+// Ack releases events up to seq.
+func (fc *flowControl) Ack(seq uint64) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	n := 0
+	for _, e := range fc.outstanding {
+		if e.seq > seq {
+			break
+		}
+		fc.unacked -= e.size
+		n += 1
+	}
+	fc.outstanding = fc.outstanding[n:]
+	fc.cond.Broadcast()
+}
+
+// Full returns whether unacknowledged bytes reach the limit.
+func (fc *flowControl) Full() bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.fullLocked()
+}
+
+func (fc *flowControl) fullLocked() bool {
+	return fc.Enabled() && !fc.closed && fc.unacked >= fc.limit
+}
+
+// Wait blocks until unacknowledged bytes are under the limit or Close is called.
+func (fc *flowControl) Wait() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for fc.fullLocked() {
+		fc.cond.Wait()
+	}
+}
+
+// Close releases all of waiting and disables further blocking, e.g. on quitting engine.
+func (fc *flowControl) Close() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.closed = true
+	fc.cond.Broadcast()
+}
@@ -4,8 +4,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"sync"
 	"syscall/js"
+	"time"
 
 	model "github.com/mzki/erago/mobile/model/v2"
 )
@@ -29,43 +32,170 @@ const (
 var _ model.UI = &uiMessenger{}
 
 type uiMessenger struct {
-	done chan (struct{})
+	done       chan (struct{})
+	scrollback *scrollback
+	batcher    *eventBatcher // nil when batching is disabled.
+	flow       *flowControl
+	transcript *transcriptWriter
+	recorder   *sessionRecorder // nil unless session recording is enabled.
+	replayer   *sessionReplayer // nil unless replaying session.
+	macro      *macroRunner
+
+	tempMu        sync.Mutex
+	coalescedTemp []byte // temporary paragraph held back by flow control.
+	coalescedSeq  uint64
+	hasCoalesced  bool
 }
 
-func newUiMessenger() *uiMessenger {
-	return &uiMessenger{done: make(chan struct{})}
+func newUiMessenger(opt EngineOptions, transcript *transcriptWriter, recorder *sessionRecorder, replayer *sessionReplayer) *uiMessenger {
+	ui := &uiMessenger{
+		done:       make(chan struct{}),
+		scrollback: newScrollback(opt.ScrollbackSize),
+		flow:       newFlowControl(opt.MaxUnackedBytes),
+		transcript: transcript,
+		recorder:   recorder,
+		replayer:   replayer,
+	}
+	ui.macro = newMacroRunner(opt.MacroMaxIterations, opt.MessageByteEncoding, func(command string) {
+		ui.recordInput("send_command", command)
+		model.SendCommand(command)
+	})
+	if opt.EventBatchWindow > 0 {
+		ui.batcher = newEventBatcher(opt.EventBatchWindow)
+	}
+	return ui
+}
+
+// emit sends event with sequence number to UI. flushNow is used for events which UI should
+// handle without waiting batch window, such as input request.
+func (ui *uiMessenger) emit(cbID EngineCallbackID, seq uint64, payload any, flushNow bool) {
+	if ui.batcher != nil {
+		ui.batcher.Add(toEngineEvent(cbID, seq, payload), flushNow)
+	} else {
+		sendEventToJs(cbID, payload, seq)
+	}
+}
+
+// emitParagraph sends paragraph and records its size for flow control.
+func (ui *uiMessenger) emitParagraph(cbID EngineCallbackID, seq uint64, bs []byte) {
+	ui.flow.Track(seq, int64(len(bs)))
+	ui.emit(cbID, seq, ToJsBytes(bs), false)
+}
+
+// takeCoalescedTemporary returns temporary paragraph held back by flow control, and clears it.
+func (ui *uiMessenger) takeCoalescedTemporary() (seq uint64, bs []byte, ok bool) {
+	ui.tempMu.Lock()
+	defer ui.tempMu.Unlock()
+	seq, bs, ok = ui.coalescedSeq, ui.coalescedTemp, ui.hasCoalesced
+	ui.coalescedSeq, ui.coalescedTemp, ui.hasCoalesced = 0, nil, false
+	return
+}
+
+// flushCoalescedTemporary sends temporary paragraph held back by flow control if exists.
+func (ui *uiMessenger) flushCoalescedTemporary() {
+	if seq, bs, ok := ui.takeCoalescedTemporary(); ok {
+		ui.emitParagraph(EngineOnPublishBytesTemporary, seq, bs)
+	}
+}
+
+// recordInput records input method if session recording is enabled.
+func (ui *uiMessenger) recordInput(method string, command string, values ...float64) {
+	if ui.recorder != nil {
+		ui.recorder.RecordInput(method, command, values...)
+	}
+}
+
+// Ack is called when UI consumed events up to seq.
+func (ui *uiMessenger) Ack(seq uint64) {
+	ui.flow.Ack(seq)
+	if !ui.flow.Full() {
+		ui.flushCoalescedTemporary()
+	}
 }
 
 func (ui *uiMessenger) OnPublishBytes(bs []byte) error {
-	sendEventToJs(EngineOnPublishBytes, ToJsBytes(bs))
+	ui.flow.Wait()
+	ui.takeCoalescedTemporary() // superseded by fixed paragraph.
+	seq := ui.scrollback.Publish(bs)
+	theCrashReporter.RecordParagraph(bs)
+	ui.transcript.WriteParagraph(bs)
+	if ui.recorder != nil {
+		ui.recorder.RecordOutput(bs)
+	}
+	if ui.replayer != nil {
+		ui.replayer.CheckOutput(bs)
+	}
+	ui.macro.RecordOutput(bs)
+	ui.emitParagraph(EngineOnPublishBytes, seq, bs)
 	return nil
 }
 func (ui *uiMessenger) OnPublishBytesTemporary(bs []byte) error {
-	sendEventToJs(EngineOnPublishBytesTemporary, ToJsBytes(bs))
+	seq := ui.scrollback.PublishTemporary(bs)
+	if ui.flow.Full() {
+		// only the latest temporary paragraph is meaningful. hold it until UI catches up.
+		ui.tempMu.Lock()
+		ui.coalescedSeq, ui.coalescedTemp, ui.hasCoalesced = seq, bytes.Clone(bs), true
+		ui.tempMu.Unlock()
+		return nil
+	}
+	ui.takeCoalescedTemporary() // superseded by this one.
+	ui.emitParagraph(EngineOnPublishBytesTemporary, seq, bs)
 	return nil
 }
 func (ui *uiMessenger) OnRemove(nParagraph int) error {
-	sendEventToJs(EngineOnRemove, nParagraph)
+	ui.takeCoalescedTemporary() // removed anyway.
+	seq := ui.scrollback.Remove(nParagraph)
+	ui.emit(EngineOnRemove, seq, nParagraph, false)
+	return nil
+}
+func (ui *uiMessenger) OnRemoveAll() error {
+	ui.takeCoalescedTemporary() // removed anyway.
+	seq := ui.scrollback.RemoveAll()
+	ui.emit(EngineOnRemoveAll, seq, nil, false)
 	return nil
 }
-func (ui *uiMessenger) OnRemoveAll() error { sendEventToJs(EngineOnRemoveAll); return nil }
 
 // it is called when mobile.app requires inputting
 // user's command.
-func (ui *uiMessenger) OnCommandRequested() { sendEventToJs(EngineOnCommandRequested) }
+func (ui *uiMessenger) OnCommandRequested() {
+	theEngineState.SetInputRequest(InputRequestCommand)
+	ui.flushCoalescedTemporary() // UI should show prompt before input.
+	ui.emit(EngineOnCommandRequested, ui.scrollback.Advance(), nil, true)
+	if ui.replayer != nil {
+		ui.replayer.OnInputRequested()
+	}
+	ui.macro.OnCommandRequested()
+}
 
 // it is called when mobile.app requires just input any command.
-func (ui *uiMessenger) OnInputRequested() { sendEventToJs(EngineOnInputRequested) }
+func (ui *uiMessenger) OnInputRequested() {
+	theEngineState.SetInputRequest(InputRequestInput)
+	ui.flushCoalescedTemporary() // UI should show prompt before input.
+	ui.emit(EngineOnInputRequested, ui.scrollback.Advance(), nil, true)
+	if ui.replayer != nil {
+		ui.replayer.OnInputRequested()
+	}
+}
 
 // it is called when mobile.app no longer requires any input,
 // such as just-input and command.
-func (ui *uiMessenger) OnInputRequestClosed() { sendEventToJs(EngineOnInputRequestClosed) }
+func (ui *uiMessenger) OnInputRequestClosed() {
+	theEngineState.SetInputRequest(InputRequestNone)
+	ui.flushCoalescedTemporary() // UI should show prompt before input.
+	ui.emit(EngineOnInputRequestClosed, ui.scrollback.Advance(), nil, true)
+}
 
 func (ui *uiMessenger) NotifyQuit(err error) {
+	ui.flow.Close()
+	if ui.replayer != nil {
+		ui.replayer.Finish()
+	}
+	ui.macro.Stop(MacroStopEngineQuit)
+	seq := ui.scrollback.Advance()
 	if err != nil {
-		sendEventToJs(EngineNotifyQuit, err.Error())
+		ui.emit(EngineNotifyQuit, seq, err.Error(), true)
 	} else {
-		sendEventToJs(EngineNotifyQuit, nil)
+		ui.emit(EngineNotifyQuit, seq, nil, true)
 	}
 	// close should be last since it blocks main()
 	close(ui.done)
@@ -89,17 +219,63 @@ func sendEventToJs(cbID EngineCallbackID, args ...any) {
 type EngineOptions struct {
 	ImageFetchType      int
 	MessageByteEncoding int
+	SaveBackupCount     int
+	LogRotate           LogRotateOptions
+	ScrollbackSize      int
+	EventBatchWindow    time.Duration // zero or negative disables batching.
+	MaxUnackedBytes     int64         // zero or negative disables flow control by ack_events.
+	RecordSession       bool
+	RecordTranscript    bool
+	CommandHistorySize  int
+	MacroMaxIterations  int
 }
 
 const (
 	EngineOptionsKeyImageFetchTyoe      = "imageFetchType"
 	EngineOptionsKeyMessageByteEncoding = "messageByteEncoding"
+	EngineOptionsKeySaveBackupCount     = "saveBackupCount"
+	EngineOptionsKeyLogMaxSize          = "logMaxSize"
+	EngineOptionsKeyLogMaxFiles         = "logMaxFiles"
+	EngineOptionsKeyLogCompress         = "logCompress"
+	EngineOptionsKeyScrollbackSize      = "scrollbackSize"
+	EngineOptionsKeyEventBatchWindowMs  = "eventBatchWindowMs"
+	EngineOptionsKeyMaxUnackedBytes     = "maxUnackedBytes"
+	EngineOptionsKeyRecordSession       = "recordSession"
+	EngineOptionsKeyRecordTranscript    = "recordTranscript"
+	EngineOptionsKeyCommandHistorySize  = "commandHistorySize"
+	EngineOptionsKeyMacroMaxIterations  = "macroMaxIterations"
 )
 
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (opt *EngineOptions) ToJsValue() map[string]any {
+	return map[string]any{
+		EngineOptionsKeyImageFetchTyoe:      opt.ImageFetchType,
+		EngineOptionsKeyMessageByteEncoding: opt.MessageByteEncoding,
+		EngineOptionsKeySaveBackupCount:     opt.SaveBackupCount,
+		EngineOptionsKeyLogMaxSize:          opt.LogRotate.MaxSize,
+		EngineOptionsKeyLogMaxFiles:         opt.LogRotate.MaxFiles,
+		EngineOptionsKeyLogCompress:         opt.LogRotate.Compress,
+		EngineOptionsKeyScrollbackSize:      opt.ScrollbackSize,
+		EngineOptionsKeyEventBatchWindowMs:  opt.EventBatchWindow.Milliseconds(),
+		EngineOptionsKeyMaxUnackedBytes:     opt.MaxUnackedBytes,
+		EngineOptionsKeyRecordSession:       opt.RecordSession,
+		EngineOptionsKeyRecordTranscript:    opt.RecordTranscript,
+		EngineOptionsKeyCommandHistorySize:  opt.CommandHistorySize,
+		EngineOptionsKeyMacroMaxIterations:  opt.MacroMaxIterations,
+	}
+}
+
 func ParseEngineOptions(opt js.Value) EngineOptions {
 	defaultOpt := EngineOptions{
 		ImageFetchType:      model.ImageFetchEncodedPNG,
 		MessageByteEncoding: model.MessageByteEncodingJson,
+		SaveBackupCount:     DefaultSaveBackupCount,
+		LogRotate:           DefaultLogRotateOptions,
+		ScrollbackSize:      DefaultScrollbackSize,
+		EventBatchWindow:    DefaultEventBatchWindow,
+		RecordTranscript:    true,
+		CommandHistorySize:  DefaultCommandHistorySize,
+		MacroMaxIterations:  DefaultMacroMaxIterations,
 	}
 	if opt.Type() != js.TypeObject {
 		return defaultOpt
@@ -113,17 +289,60 @@ func ParseEngineOptions(opt js.Value) EngineOptions {
 		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyMessageByteEncoding, v)
 		defaultOpt.MessageByteEncoding = v.Int()
 	}
+	if v := opt.Get(EngineOptionsKeySaveBackupCount); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeySaveBackupCount, v)
+		defaultOpt.SaveBackupCount = v.Int()
+	}
+	if v := opt.Get(EngineOptionsKeyLogMaxSize); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyLogMaxSize, v)
+		defaultOpt.LogRotate.MaxSize = int64(v.Float())
+	}
+	if v := opt.Get(EngineOptionsKeyLogMaxFiles); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyLogMaxFiles, v)
+		defaultOpt.LogRotate.MaxFiles = v.Int()
+	}
+	if v := opt.Get(EngineOptionsKeyLogCompress); v.Type() == js.TypeBoolean {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyLogCompress, v)
+		defaultOpt.LogRotate.Compress = v.Bool()
+	}
+	if v := opt.Get(EngineOptionsKeyScrollbackSize); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyScrollbackSize, v)
+		defaultOpt.ScrollbackSize = v.Int()
+	}
+	if v := opt.Get(EngineOptionsKeyEventBatchWindowMs); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyEventBatchWindowMs, v)
+		defaultOpt.EventBatchWindow = time.Duration(v.Int()) * time.Millisecond
+	}
+	if v := opt.Get(EngineOptionsKeyMaxUnackedBytes); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyMaxUnackedBytes, v)
+		defaultOpt.MaxUnackedBytes = int64(v.Float())
+	}
+	if v := opt.Get(EngineOptionsKeyRecordSession); v.Type() == js.TypeBoolean {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyRecordSession, v)
+		defaultOpt.RecordSession = v.Bool()
+	}
+	if v := opt.Get(EngineOptionsKeyRecordTranscript); v.Type() == js.TypeBoolean {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyRecordTranscript, v)
+		defaultOpt.RecordTranscript = v.Bool()
+	}
+	if v := opt.Get(EngineOptionsKeyCommandHistorySize); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyCommandHistorySize, v)
+		defaultOpt.CommandHistorySize = v.Int()
+	}
+	if v := opt.Get(EngineOptionsKeyMacroMaxIterations); v.Type() == js.TypeNumber {
+		fmt.Printf("Found options.%s = %v\n", EngineOptionsKeyMacroMaxIterations, v)
+		defaultOpt.MacroMaxIterations = v.Int()
+	}
 	return defaultOpt
 }
 
-func InitEngine(baseDir string, fsys model.FileSystemGlob, opt EngineOptions) (messenger *uiMessenger, quitFunc func(), err error) {
-	messenger = newUiMessenger()
+func InitEngine(baseDir string, fsys model.FileSystemGlob, messenger *uiMessenger, opt EngineOptions) (quitFunc func(), err error) {
 	if err := model.Init(messenger, baseDir, &model.InitOptions{
 		ImageFetchType:      opt.ImageFetchType,
 		MessageByteEncoding: opt.MessageByteEncoding,
 		FileSystem:          fsys,
 	}); err != nil {
-		return nil, nil, fmt.Errorf("init Error: %w", err)
+		return nil, fmt.Errorf("init Error: %w", err)
 	}
 	quitFunc = func() {
 		model.Quit()
@@ -132,67 +351,237 @@ func InitEngine(baseDir string, fsys model.FileSystemGlob, opt EngineOptions) (m
 	return
 }
 
-func RunEngine(appCtx model.AppContext) {
-	model.Main(appCtx)
+func RunEngine(messenger *uiMessenger) {
+	model.Main(messenger)
 }
 
-func RunIO() (cancelFunc func()) {
+func RunIO(messenger *uiMessenger, history *commandHistory, macros *macroStore) (cancelFunc func()) {
 	ioCallbacks := js.FuncOf(func(this js.Value, args []js.Value) any {
 		data := args[0].Get("data")
 		switch methodName := data.Index(0).String(); methodName {
 		case "send_command":
 			ConsumeMessageEvent(args[0])
-			go func() { // to avoid blocking js eventLoop
-				model.SendCommand(data.Index(1).String())
+			command := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.recordInput(methodName, command)
+				model.SendCommand(command)
+				if err := history.Add(command); err != nil {
+					fmt.Printf("command history: %v\n", err)
+				}
 				SendBackMethodOK(methodName)
-			}()
+			})
 		case "send_ctrl_skipping_wait":
 			ConsumeMessageEvent(args[0])
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.recordInput(methodName, "")
 				model.SendSkippingWait()
+				theEngineState.SetSkippingWait(true)
 				SendBackMethodOK(methodName)
-			}()
+			})
 		case "send_ctrl_stop_skipping_wait":
 			ConsumeMessageEvent(args[0])
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.recordInput(methodName, "")
 				model.SendStopSkippingWait()
+				theEngineState.SetSkippingWait(false)
 				SendBackMethodOK(methodName)
-			}()
+			})
 		case "send_quit":
 			ConsumeMessageEvent(args[0])
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.flow.Close() // engine may be blocked by waiting ack.
 				model.Quit()
 				SendBackMethodOK(methodName)
-			}()
+			})
 		case "set_textunit_px":
 			ConsumeMessageEvent(args[0])
 			wPx := data.Index(1).Float()
 			hPx := data.Index(2).Float()
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				if err := model.SetTextUnitPx(wPx, hPx); err != nil {
 					SendBackMethodError(methodName, err)
+					return
 				}
+				theEngineState.SetTextUnitPx(wPx, hPx)
+				messenger.recordInput(methodName, "", wPx, hPx)
 				SendBackMethodOK(methodName)
-			}()
+			})
 
 		case "set_viewsize":
 			ConsumeMessageEvent(args[0])
 			lineCount := data.Index(1).Int()
 			lineWidth := data.Index(2).Int()
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				if err := model.SetViewSize(lineCount, lineWidth); err != nil {
 					SendBackMethodError(methodName, err)
+					return
 				}
+				theEngineState.SetViewSize(lineCount, lineWidth)
+				messenger.recordInput(methodName, "", float64(lineCount), float64(lineWidth))
 				SendBackMethodOK(methodName)
-			}()
+			})
+
+		case "ack_events":
+			ConsumeMessageEvent(args[0])
+			seq := uint64(max(data.Index(1).Float(), 0))
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.Ack(seq)
+				SendBackMethodOK(methodName)
+			})
+
+		case "replay_paragraphs":
+			ConsumeMessageEvent(args[0])
+			var fromSeq uint64
+			if v := data.Index(1); v.Type() == js.TypeNumber {
+				fromSeq = uint64(max(v.Float(), 0))
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				replay := messenger.scrollback.Replay(fromSeq)
+				SendBackParagraphReplay(methodName, replay)
+			})
+
+		case "export_transcript":
+			ConsumeMessageEvent(args[0])
+			var formatStr string
+			if v := data.Index(1); v.Type() == js.TypeString {
+				formatStr = v.String()
+			}
+			format, err := ParseTranscriptFormat(formatStr)
+			if err != nil {
+				SendBackMethodError(methodName, err)
+				return nil
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				bs, err := messenger.transcript.Export(format)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackTranscriptBytes(methodName, ToJsBytes(bs))
+			})
+
+		case "get_command_history":
+			ConsumeMessageEvent(args[0])
+			var limit int
+			if v := data.Index(1); v.Type() == js.TypeNumber {
+				limit = v.Int()
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				SendBackCommandHistory(methodName, history.List(limit))
+			})
+
+		case "search_command_history":
+			ConsumeMessageEvent(args[0])
+			var prefix string
+			if v := data.Index(1); v.Type() == js.TypeString {
+				prefix = v.String()
+			}
+			var limit int
+			if v := data.Index(2); v.Type() == js.TypeNumber {
+				limit = v.Int()
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				SendBackCommandHistory(methodName, history.Search(prefix, limit))
+			})
+
+		case "clear_command_history":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := history.Clear(); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "define_macro":
+			ConsumeMessageEvent(args[0])
+			macroJson := data.Index(1)
+			if macroJson.Type() != js.TypeString {
+				macroJson = js.Global().Get("JSON").Call("stringify", macroJson)
+			}
+			macroStr := macroJson.String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				m, err := ParseMacro([]byte(macroStr))
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				if err := macros.Define(m); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "delete_macro":
+			ConsumeMessageEvent(args[0])
+			name := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := macros.Delete(name); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "list_macros":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				bs, err := macros.MarshalList()
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMacros(methodName, string(bs))
+			})
+
+		case "run_macro":
+			ConsumeMessageEvent(args[0])
+			name := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				m, err := macros.Get(name)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				waitingCommand := theEngineState.InputRequest() == InputRequestCommand
+				if err := messenger.macro.Start(m, waitingCommand); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "stop_macro":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				messenger.macro.Stop(MacroStopStopped)
+				SendBackMethodOK(methodName)
+			})
+
+		case "export_session":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if messenger.recorder == nil {
+					SendBackMethodError(methodName, fmt.Errorf("session recording is disabled, set options.%s", EngineOptionsKeyRecordSession))
+					return
+				}
+				bs, err := messenger.recorder.Marshal()
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackSessionRecordBytes(methodName, ToJsBytes(bs))
+			})
 
 		case "string_width":
 			ConsumeMessageEvent(args[0])
 			text := data.Index(1).String()
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				width := model.StringWidth(text)
 				SendBackStringWidth(methodName, width)
-			}()
+			})
 
 		}
 		return nil
@@ -0,0 +1,118 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	// commandHistoryFile stores commands sent by send_command under the package root.
+	commandHistoryFile = ".erago-wasm-command-history.json"
+	// DefaultCommandHistorySize is the default number of commands kept in history.
+	DefaultCommandHistorySize = 1000
+)
+
+// commandHistory is a persistent history of commands, like shell history.
+// Empty commands and consecutive duplicates are not recorded.
+type commandHistory struct {
+	fsys     *WebFileSystem // package root.
+	capacity int
+
+	mu       sync.Mutex
+	commands []string // older first.
+}
+
+// newCommandHistory loads history from fsys. Broken history file is discarded.
+func newCommandHistory(fsys *WebFileSystem, capacity int) *commandHistory {
+	if capacity <= 0 {
+		capacity = DefaultCommandHistorySize
+	}
+	h := &commandHistory{fsys: fsys, capacity: capacity}
+	if !fsys.Exist(commandHistoryFile) {
+		return h
+	}
+	content, err := readAllFile(fsys, commandHistoryFile)
+	if err == nil {
+		err = json.Unmarshal(content, &h.commands)
+	}
+	if err != nil {
+		fmt.Printf("command history: discard broken history: %v\n", err)
+		h.commands = nil
+	}
+	h.trimLocked()
+	return h
+}
+
+func (h *commandHistory) trimLocked() {
+	if over := len(h.commands) - h.capacity; over > 0 {
+		h.commands = h.commands[over:]
+	}
+}
+
+func (h *commandHistory) persistLocked() error {
+	content, err := json.Marshal(h.commands)
+	if err != nil {
+		return err
+	}
+	return writeAllFile(h.fsys, commandHistoryFile, content)
+}
+
+// Add appends command to history and persists it.
+func (h *commandHistory) Add(command string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if command == "" || (len(h.commands) > 0 && h.commands[len(h.commands)-1] == command) {
+		return nil
+	}
+	h.commands = append(h.commands, command)
+	h.trimLocked()
+	return h.persistLocked()
+}
+
+// List returns last limit commands, older first. limit <= 0 returns all.
+func (h *commandHistory) List(limit int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	commands := h.commands
+	if limit > 0 && len(commands) > limit {
+		commands = commands[len(commands)-limit:]
+	}
+	return append([]string{}, commands...)
+}
+
+// Search returns distinct commands starting with prefix, newer first, up to limit.
+// limit <= 0 returns all of matches.
+func (h *commandHistory) Search(prefix string, limit int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var matches []string
+	seen := make(map[string]struct{})
+	for i := len(h.commands) - 1; i >= 0; i-- {
+		if limit > 0 && len(matches) >= limit {
+			break
+		}
+		command := h.commands[i]
+		if _, ok := seen[command]; ok || !strings.HasPrefix(command, prefix) {
+			continue
+		}
+		seen[command] = struct{}{}
+		matches = append(matches, command)
+	}
+	return matches
+}
+
+// Clear removes all of history.
+func (h *commandHistory) Clear() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.commands = nil
+	if !h.fsys.Exist(commandHistoryFile) {
+		return nil
+	}
+	return h.fsys.Remove(commandHistoryFile)
+}
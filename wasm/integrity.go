@@ -0,0 +1,232 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mzki/erago/app"
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+// IntegrityManifestFile is the file name of integrity manifest stored in the installed package root.
+const IntegrityManifestFile = ".erago-wasm-integrity.json"
+
+// IntegrityManifest records checksums of files extracted by install.
+type IntegrityManifest struct {
+	CreatedAt time.Time            `json:"createdAt"`
+	Files     []IntegrityFileEntry `json:"files"`
+}
+
+// IntegrityFileEntry is a file record in IntegrityManifest. Path is slash separated and relative to the package root.
+type IntegrityFileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+var ErrNoIntegrityManifest = errors.New("integrity manifest not found")
+
+// InstallPackageWithIntegrity installs archive into outFsys same as model.InstallPackage,
+// and records IntegrityManifest into the extracted directory.
+// The archive can be any format supported by NormalizePackageArchive, and is extracted within limits.
+func InstallPackageWithIntegrity(outFsys *WebFileSystem, archiveBytes []byte, limits ArchiveLimits) (extractedDir string, err error) {
+	zipBytes, err := NormalizePackageArchive(archiveBytes, limits)
+	if err != nil {
+		return "", err
+	}
+	if err := limits.CheckZip(zipBytes); err != nil {
+		return "", err
+	}
+	hashFsys := newHashingFileSystem(NewLimitFileSystem(outFsys, limits))
+	extractedDir, err = model.InstallPackage(hashFsys, zipBytes)
+	if err != nil {
+		return extractedDir, err
+	}
+
+	manifest := IntegrityManifest{
+		CreatedAt: time.Now(),
+		Files:     make([]IntegrityFileEntry, 0, len(hashFsys.entries)),
+	}
+	for path, entry := range hashFsys.entries {
+		rel, err := filepath.Rel(extractedDir, path)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue // not a part of the package.
+		}
+		entry.Path = filepath.ToSlash(rel)
+		manifest.Files = append(manifest.Files, entry)
+	}
+	slices.SortFunc(manifest.Files, func(a, b IntegrityFileEntry) int { return strings.Compare(a.Path, b.Path) })
+
+	if err := writeIntegrityManifest(outFsys, filepath.Join(extractedDir, IntegrityManifestFile), &manifest); err != nil {
+		return extractedDir, fmt.Errorf("failed to record integrity manifest: %w", err)
+	}
+	return extractedDir, nil
+}
+
+func writeIntegrityManifest(fsys *WebFileSystem, path string, manifest *IntegrityManifest) error {
+	bs, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAllFile(fsys, path, bs)
+}
+
+func readIntegrityManifest(pkgFsys *WebFileSystem) (*IntegrityManifest, error) {
+	if !pkgFsys.Exist(IntegrityManifestFile) {
+		return nil, ErrNoIntegrityManifest
+	}
+	bs, err := readAllFile(pkgFsys, IntegrityManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &IntegrityManifest{}
+	if err := json.Unmarshal(bs, manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", IntegrityManifestFile, err)
+	}
+	return manifest, nil
+}
+
+// IntegrityReport is a result of VerifyPackage. Paths are relative to the package root.
+type IntegrityReport struct {
+	Missing  []string
+	Modified []string
+	Extra    []string
+}
+
+// OK returns true when no missing and modified files are found. Extra files do not affect the result.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *IntegrityReport) ToJsValue() map[string]any {
+	return map[string]any{
+		"ok":       r.OK(),
+		"missing":  stringsToAny(r.Missing),
+		"modified": stringsToAny(r.Modified),
+		"extra":    stringsToAny(r.Extra),
+	}
+}
+
+// VerifyPackage rehashes files in the package at rootPath and compares them with IntegrityManifest
+// recorded on install. Files written by engine at runtime, such as save files, and patch backups
+// are not reported as extra.
+func VerifyPackage(fsys *WebFileSystem, rootPath string) (*IntegrityReport, error) {
+	pkgFsys, err := fsys.Sub(rootPath, false)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readIntegrityManifest(pkgFsys)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IntegrityReport{
+		Missing:  []string{},
+		Modified: []string{},
+		Extra:    []string{},
+	}
+	known := make(map[string]bool, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		known[entry.Path] = true
+		path := filepath.FromSlash(entry.Path)
+		if !pkgFsys.Exist(path) {
+			report.Missing = append(report.Missing, entry.Path)
+			continue
+		}
+		content, err := readAllFile(pkgFsys, path)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) != entry.Size || sha256Hex(content) != entry.SHA256 {
+			report.Modified = append(report.Modified, entry.Path)
+		}
+	}
+
+	var runtimeDirs, runtimeFiles []string
+	if appConf, err := LoadPackageConfig(pkgFsys); err == nil || errors.Is(err, app.ErrDefaultConfigGenerated) {
+		runtimeDirs = packageRuntimeDirs(appConf)
+		runtimeFiles = packageRuntimeFiles()
+	}
+	runtimeDirs = append(runtimeDirs, patchRootDir)
+	files, err := pkgFsys.WalkFiles(".")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		slashFile := filepath.ToSlash(file)
+		if known[slashFile] || file == IntegrityManifestFile || slices.Contains(runtimeFiles, file) {
+			continue
+		}
+		if slices.ContainsFunc(runtimeDirs, func(dir string) bool { return strings.HasPrefix(file, dir+string(filepath.Separator)) }) {
+			continue
+		}
+		report.Extra = append(report.Extra, slashFile)
+	}
+	return report, nil
+}
+
+// hashingFileSystem records checksums of files written through Store.
+type hashingFileSystem struct {
+	model.FileSystem
+
+	mu      *sync.Mutex
+	entries map[string]IntegrityFileEntry
+}
+
+func newHashingFileSystem(fsys model.FileSystem) *hashingFileSystem {
+	return &hashingFileSystem{
+		FileSystem: fsys,
+		mu:         new(sync.Mutex),
+		entries:    make(map[string]IntegrityFileEntry),
+	}
+}
+
+func (fsys *hashingFileSystem) Store(fpath string) (model.WriteCloser, error) {
+	w, err := fsys.FileSystem.Store(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &hashingWriter{WriteCloser: w, path: fpath, hash: sha256.New(), fsys: fsys}, nil
+}
+
+type hashingWriter struct {
+	model.WriteCloser
+	path string
+	size int64
+	hash hash.Hash
+	fsys *hashingFileSystem
+}
+
+func (w *hashingWriter) Write(bs []byte) (int, error) {
+	n, err := w.WriteCloser.Write(bs)
+	w.hash.Write(bs[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *hashingWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.fsys.mu.Lock()
+	defer w.fsys.mu.Unlock()
+	w.fsys.entries[filepath.Clean(w.path)] = IntegrityFileEntry{
+		Path:   w.path,
+		Size:   w.size,
+		SHA256: hex.EncodeToString(w.hash.Sum(nil)),
+	}
+	return nil
+}
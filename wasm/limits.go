@@ -0,0 +1,228 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall/js"
+
+	"github.com/mzki/erago/filesystem"
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+// ArchiveLimits restricts archive extraction to protect storage quota and memory from
+// malicious or broken archives, such as zip bomb. Zero or negative value means no limit.
+type ArchiveLimits struct {
+	MaxTotalSize       int64   // sum of uncompressed size of all files in bytes.
+	MaxFiles           int     // number of files.
+	MaxFileSize        int64   // uncompressed size of each file in bytes.
+	MaxCompressionRate float64 // uncompressed size / compressed size of each file.
+	MaxPathDepth       int     // number of path elements of each file.
+}
+
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxTotalSize:       512 * 1024 * 1024, // 512MByte
+	MaxFiles:           20000,
+	MaxFileSize:        filesystem.DefaultMaxFileSize, // engine can not read larger file anyway.
+	MaxCompressionRate: 200,
+	MaxPathDepth:       32,
+}
+
+// currentArchiveLimits is set by set_archive_limits. It is kept across engine lifetimes
+// since the packager is restarted every time the engine quits.
+var currentArchiveLimits = DefaultArchiveLimits
+
+const (
+	ArchiveLimitsKeyMaxTotalSize       = "maxTotalSize"
+	ArchiveLimitsKeyMaxFiles           = "maxFiles"
+	ArchiveLimitsKeyMaxFileSize        = "maxFileSize"
+	ArchiveLimitsKeyMaxCompressionRate = "maxCompressionRate"
+	ArchiveLimitsKeyMaxPathDepth       = "maxPathDepth"
+)
+
+// ParseArchiveLimits overrides base by fields found in js object opt.
+func ParseArchiveLimits(base ArchiveLimits, opt js.Value) ArchiveLimits {
+	if opt.Type() != js.TypeObject {
+		return base
+	}
+	if v := opt.Get(ArchiveLimitsKeyMaxTotalSize); v.Type() == js.TypeNumber {
+		base.MaxTotalSize = int64(v.Float())
+	}
+	if v := opt.Get(ArchiveLimitsKeyMaxFiles); v.Type() == js.TypeNumber {
+		base.MaxFiles = v.Int()
+	}
+	if v := opt.Get(ArchiveLimitsKeyMaxFileSize); v.Type() == js.TypeNumber {
+		base.MaxFileSize = int64(v.Float())
+	}
+	if v := opt.Get(ArchiveLimitsKeyMaxCompressionRate); v.Type() == js.TypeNumber {
+		base.MaxCompressionRate = v.Float()
+	}
+	if v := opt.Get(ArchiveLimitsKeyMaxPathDepth); v.Type() == js.TypeNumber {
+		base.MaxPathDepth = v.Int()
+	}
+	return base
+}
+
+var ErrArchiveLimitExceeded = errors.New("archive limit exceeded")
+
+// ArchiveLimitError is returned when archive exceeds one of ArchiveLimits.
+// Limit is the key name of ArchiveLimits, e.g. "maxFileSize".
+type ArchiveLimitError struct {
+	Limit string
+	Path  string // empty when the limit is not related to specific file.
+	Value any
+	Max   any
+}
+
+func (e *ArchiveLimitError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%v: %s: %v > %v", ErrArchiveLimitExceeded, e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%v: %s: %s: %v > %v", ErrArchiveLimitExceeded, e.Limit, e.Path, e.Value, e.Max)
+}
+
+func (e *ArchiveLimitError) Is(target error) bool { return target == ErrArchiveLimitExceeded }
+
+// CheckZip validates zip headers before extraction. Since headers can be forged,
+// sizes should also be checked while extracting by LimitFileSystem.
+func (l ArchiveLimits) CheckZip(zipBytes []byte) error {
+	zReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return err
+	}
+	var nFiles int
+	var totalSize uint64
+	for _, zf := range zReader.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		nFiles += 1
+		if l.MaxFiles > 0 && nFiles > l.MaxFiles {
+			return &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxFiles, Value: nFiles, Max: l.MaxFiles}
+		}
+		if depth := len(strings.Split(strings.Trim(zf.Name, "/"), "/")); l.MaxPathDepth > 0 && depth > l.MaxPathDepth {
+			return &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxPathDepth, Path: zf.Name, Value: depth, Max: l.MaxPathDepth}
+		}
+		if l.MaxFileSize > 0 && zf.UncompressedSize64 > uint64(l.MaxFileSize) {
+			return &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxFileSize, Path: zf.Name, Value: zf.UncompressedSize64, Max: l.MaxFileSize}
+		}
+		if l.MaxCompressionRate > 0 && zf.CompressedSize64 > 0 {
+			if rate := float64(zf.UncompressedSize64) / float64(zf.CompressedSize64); rate > l.MaxCompressionRate {
+				return &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxCompressionRate, Path: zf.Name, Value: rate, Max: l.MaxCompressionRate}
+			}
+		}
+		totalSize += zf.UncompressedSize64
+		if l.MaxTotalSize > 0 && totalSize > uint64(l.MaxTotalSize) {
+			return &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxTotalSize, Value: totalSize, Max: l.MaxTotalSize}
+		}
+	}
+	return nil
+}
+
+// limitTarReader returns reader which fails with ArchiveLimitError after reading more than maxTotalSize
+// and tar headers. It is used for decompressing tar stream whose size is unknown, such as tar.gz.
+func (l ArchiveLimits) limitTarReader(r io.Reader) io.Reader {
+	if l.MaxTotalSize <= 0 {
+		return r
+	}
+	// each file has 512 bytes header and padding up to 512 bytes.
+	// Without file count limit, headers are counted in maxTotalSize.
+	var overhead int64
+	if l.MaxFiles > 0 {
+		overhead = 1024 * int64(l.MaxFiles+1)
+	}
+	max := l.MaxTotalSize + overhead
+	return &limitedReader{r: r, remain: max, max: max}
+}
+
+type limitedReader struct {
+	r      io.Reader
+	remain int64
+	max    int64
+}
+
+func (r *limitedReader) Read(bs []byte) (int, error) {
+	if r.remain <= 0 {
+		return 0, &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxTotalSize, Value: fmt.Sprintf("more than %d", r.max), Max: r.max}
+	}
+	if int64(len(bs)) > r.remain {
+		bs = bs[:r.remain]
+	}
+	n, err := r.r.Read(bs)
+	r.remain -= int64(n)
+	return n, err
+}
+
+// LimitFileSystem enforces ArchiveLimits on files written through Store.
+type LimitFileSystem struct {
+	model.FileSystemGlob
+	limits ArchiveLimits
+
+	mu        *sync.Mutex
+	nFiles    int
+	totalSize int64
+}
+
+// NewLimitFileSystem wraps fsys with limits. Load, Exist and Glob are passed through fsys.
+func NewLimitFileSystem(fsys model.FileSystemGlob, limits ArchiveLimits) *LimitFileSystem {
+	return &LimitFileSystem{
+		FileSystemGlob: fsys,
+		limits:         limits,
+		mu:             new(sync.Mutex),
+	}
+}
+
+func (fsys *LimitFileSystem) Store(fpath string) (model.WriteCloser, error) {
+	fsys.mu.Lock()
+	fsys.nFiles += 1
+	nFiles := fsys.nFiles
+	fsys.mu.Unlock()
+	if l := fsys.limits; l.MaxFiles > 0 && nFiles > l.MaxFiles {
+		return nil, &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxFiles, Value: nFiles, Max: l.MaxFiles}
+	}
+	w, err := fsys.FileSystemGlob.Store(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &limitWriter{WriteCloser: w, path: fpath, fsys: fsys}, nil
+}
+
+type limitWriter struct {
+	model.WriteCloser
+	path string
+	size int64
+	fsys *LimitFileSystem
+}
+
+func (w *limitWriter) Write(bs []byte) (int, error) {
+	l := w.fsys.limits
+	if l.MaxFileSize > 0 && w.size+int64(len(bs)) > l.MaxFileSize {
+		return 0, &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxFileSize, Path: w.path, Value: w.size + int64(len(bs)), Max: l.MaxFileSize}
+	}
+	// reserve size before writing so that concurrent writers can not exceed the limit together.
+	w.fsys.mu.Lock()
+	totalSize := w.fsys.totalSize + int64(len(bs))
+	if l.MaxTotalSize > 0 && totalSize > l.MaxTotalSize {
+		w.fsys.mu.Unlock()
+		return 0, &ArchiveLimitError{Limit: ArchiveLimitsKeyMaxTotalSize, Value: totalSize, Max: l.MaxTotalSize}
+	}
+	w.fsys.totalSize = totalSize
+	w.fsys.mu.Unlock()
+
+	n, err := w.WriteCloser.Write(bs)
+	w.size += int64(n)
+	if n < len(bs) {
+		// release reserved size which is not written.
+		w.fsys.mu.Lock()
+		w.fsys.totalSize -= int64(len(bs) - n)
+		w.fsys.mu.Unlock()
+	}
+	return n, err
+}
@@ -0,0 +1,272 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+// logRotateDir stores rotated log files under the package root, e.g. [logRotateDir]/erago.log.1.
+// The smaller number is the newer.
+const logRotateDir = ".erago-wasm-logs"
+
+const gzipExt = ".gz"
+
+// LogRotateOptions configures rotation of engine log file.
+type LogRotateOptions struct {
+	MaxSize  int64 // rotate when the log file exceeds this size in bytes. zero or negative means no limit.
+	MaxFiles int   // number of rotated files to keep.
+	Compress bool  // compress rotated files by gzip.
+}
+
+var DefaultLogRotateOptions = LogRotateOptions{
+	MaxSize:  1 * 1024 * 1024, // 1MByte
+	MaxFiles: 3,
+	Compress: false,
+}
+
+// RotatingLogFileSystem rotates log file when it is opened by Store and when it grows over MaxSize.
+// Note that the engine itself also limits total log size per session by its config loglimit_megabytes.
+type RotatingLogFileSystem struct {
+	model.FileSystemGlob
+	pkgFsys *WebFileSystem
+	logPath string // relative to pkgFsys.
+	opts    LogRotateOptions
+}
+
+// NewRotatingLogFileSystem wraps fsys, whose files are stored in pkgFsys, to rotate log file at logPath.
+func NewRotatingLogFileSystem(fsys model.FileSystemGlob, pkgFsys *WebFileSystem, logPath string, opts LogRotateOptions) *RotatingLogFileSystem {
+	return &RotatingLogFileSystem{
+		FileSystemGlob: fsys,
+		pkgFsys:        pkgFsys,
+		logPath:        filepath.Clean(logPath),
+		opts:           opts,
+	}
+}
+
+func (fsys *RotatingLogFileSystem) Store(fpath string) (model.WriteCloser, error) {
+	if rel, err := fsys.pkgFsys.relPath(fpath); err != nil || filepath.Clean(rel) != fsys.logPath {
+		return fsys.FileSystemGlob.Store(fpath)
+	}
+	// keep log of previous session.
+	if err := fsys.rotate(); err != nil {
+		fmt.Printf("log rotation failed for %s: %v\n", fsys.logPath, err)
+	}
+	w, err := fsys.FileSystemGlob.Store(fpath)
+	if err != nil {
+		return nil, err
+	}
+	return &rotatingLogWriter{w: w, fpath: fpath, fsys: fsys}, nil
+}
+
+func (fsys *RotatingLogFileSystem) rotate() error {
+	return rotateLogFile(fsys.pkgFsys, fsys.logPath, fsys.opts)
+}
+
+type rotatingLogWriter struct {
+	mu    sync.Mutex
+	w     model.WriteCloser
+	fpath string
+	size  int64
+	fsys  *RotatingLogFileSystem
+}
+
+func (w *rotatingLogWriter) Write(bs []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if max := w.fsys.opts.MaxSize; max > 0 && w.size > 0 && w.size+int64(len(bs)) > max {
+		if err := w.w.Close(); err != nil {
+			return 0, err
+		}
+		if err := w.fsys.rotate(); err != nil {
+			return 0, err
+		}
+		newW, err := w.fsys.FileSystemGlob.Store(w.fpath)
+		if err != nil {
+			return 0, err
+		}
+		w.w = newW
+		w.size = 0
+	}
+	n, err := w.w.Write(bs)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Close()
+}
+
+type rotatedLog struct {
+	Path       string // relative to package root.
+	Number     int
+	Compressed bool
+}
+
+// listRotatedLogs returns rotated files of logPath from newest to oldest.
+func listRotatedLogs(pkgFsys *WebFileSystem, logPath string) ([]rotatedLog, error) {
+	if !pkgFsys.ExistDir(logRotateDir) {
+		return []rotatedLog{}, nil
+	}
+	entries, err := pkgFsys.ReadDir(logRotateDir)
+	if err != nil {
+		return nil, err
+	}
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(logPath)) + `\.(\d+)(\.gz)?$`)
+	logs := make([]rotatedLog, 0, len(entries))
+	for _, entry := range entries {
+		m := pattern.FindStringSubmatch(entry.Name)
+		if entry.IsDir || m == nil {
+			continue
+		}
+		number, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		logs = append(logs, rotatedLog{
+			Path:       filepath.Join(logRotateDir, entry.Name),
+			Number:     number,
+			Compressed: m[2] != "",
+		})
+	}
+	slices.SortFunc(logs, func(a, b rotatedLog) int { return a.Number - b.Number })
+	return logs, nil
+}
+
+// rotateLogFile moves logPath to the newest rotated file and shifts older ones.
+// Rotated files over opts.MaxFiles are removed. It does nothing when logPath is empty or not found.
+func rotateLogFile(pkgFsys *WebFileSystem, logPath string, opts LogRotateOptions) error {
+	if !pkgFsys.Exist(logPath) {
+		return nil
+	}
+	content, err := readAllFile(pkgFsys, logPath)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	logs, err := listRotatedLogs(pkgFsys, logPath)
+	if err != nil {
+		return err
+	}
+	for _, log := range slices.Backward(logs) {
+		if log.Number+1 > opts.MaxFiles {
+			if err := pkgFsys.Remove(log.Path); err != nil {
+				return err
+			}
+			continue
+		}
+		bs, err := readAllFile(pkgFsys, log.Path)
+		if err != nil {
+			return err
+		}
+		if err := writeAllFile(pkgFsys, rotatedLogPath(logPath, log.Number+1, log.Compressed), bs); err != nil {
+			return err
+		}
+		if err := pkgFsys.Remove(log.Path); err != nil {
+			return err
+		}
+	}
+	if opts.MaxFiles > 0 {
+		if opts.Compress {
+			if content, err = gzipBytes(content); err != nil {
+				return err
+			}
+		}
+		if err := writeAllFile(pkgFsys, rotatedLogPath(logPath, 1, opts.Compress), content); err != nil {
+			return err
+		}
+	}
+	return pkgFsys.Remove(logPath)
+}
+
+func rotatedLogPath(logPath string, number int, compressed bool) string {
+	name := fmt.Sprintf("%s.%d", filepath.Base(logPath), number)
+	if compressed {
+		name += gzipExt
+	}
+	return filepath.Join(logRotateDir, name)
+}
+
+func gzipBytes(content []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	gzWriter := gzip.NewWriter(buf)
+	if _, err := gzWriter.Write(content); err != nil {
+		return nil, err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportLogZip archives log file and its rotated files of the package at rootPath into zip bytes.
+// Compressed rotated files are stored as decompressed. Missing log files result in empty zip.
+func ExportLogZip(fsys *WebFileSystem, rootPath string, logPath string) ([]byte, error) {
+	pkgFsys, err := fsys.subOrSelf(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := listRotatedLogs(pkgFsys, logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	addFile := func(name string, content []byte) error {
+		w, err := zWriter.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+	if pkgFsys.Exist(logPath) {
+		content, err := readAllFile(pkgFsys, logPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := addFile(filepath.Base(logPath), content); err != nil {
+			return nil, err
+		}
+	}
+	for _, log := range logs {
+		content, err := readAllFile(pkgFsys, log.Path)
+		if err != nil {
+			return nil, err
+		}
+		if log.Compressed {
+			gzReader, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", log.Path, err)
+			}
+			content, err = io.ReadAll(gzReader)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", log.Path, err)
+			}
+		}
+		if err := addFile(filepath.Base(rotatedLogPath(logPath, log.Number, false)), content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,154 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+
+	model "github.com/mzki/erago/mobile/model/v2"
+	"github.com/mzki/erago/util/log"
+)
+
+const (
+	LogLevelInfo  = "info"
+	LogLevelDebug = "debug"
+)
+
+// logStream delivers engine log lines to UI as logEvent while subscribed.
+type logStream struct {
+	mu         sync.Mutex
+	subscribed bool
+}
+
+var theLogStream = &logStream{}
+
+func (s *logStream) Subscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribed = true
+}
+
+func (s *logStream) Unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribed = false
+}
+
+func (s *logStream) Subscribed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribed
+}
+
+func (s *logStream) publish(line string, timestamp time.Time) {
+	if !s.Subscribed() {
+		return
+	}
+	level := LogLevelInfo
+	if strings.Contains(line, log.DebugPrefix) {
+		level = LogLevelDebug
+	}
+	SendBackLogEvent(level, timestamp, line)
+}
+
+// LogStreamFileSystem taps writes to the engine log file and publishes them line by line.
+type LogStreamFileSystem struct {
+	model.FileSystemGlob
+	logPath string // absolute path.
+	baseDir string
+	stream  *logStream
+}
+
+// NewLogStreamFileSystem wraps fsys, which is rooted at baseDir, to tap log file at logPath.
+// logPath is relative to baseDir.
+func NewLogStreamFileSystem(fsys model.FileSystemGlob, baseDir string, logPath string) *LogStreamFileSystem {
+	return &LogStreamFileSystem{
+		FileSystemGlob: fsys,
+		logPath:        filepath.Join(baseDir, logPath),
+		baseDir:        baseDir,
+		stream:         theLogStream,
+	}
+}
+
+func (fsys *LogStreamFileSystem) Store(fpath string) (model.WriteCloser, error) {
+	w, err := fsys.FileSystemGlob.Store(fpath)
+	if err != nil {
+		return nil, err
+	}
+	absPath := fpath
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(fsys.baseDir, absPath)
+	}
+	if filepath.Clean(absPath) != fsys.logPath {
+		return w, nil
+	}
+	return &logStreamWriter{WriteCloser: w, stream: fsys.stream}, nil
+}
+
+type logStreamWriter struct {
+	model.WriteCloser
+	stream *logStream
+	buf    bytes.Buffer // incomplete line.
+}
+
+func (w *logStreamWriter) Write(bs []byte) (int, error) {
+	n, err := w.WriteCloser.Write(bs)
+	if !w.stream.Subscribed() {
+		w.buf.Reset()
+		return n, err
+	}
+	w.buf.Write(bs[:n])
+	now := time.Now()
+	for {
+		line, readErr := w.buf.ReadString('\n')
+		if readErr != nil {
+			// keep incomplete line until rest of it comes.
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		w.stream.publish(strings.TrimRight(line, "\r\n"), now)
+	}
+	return n, err
+}
+
+func (w *logStreamWriter) Close() error {
+	if rest := w.buf.String(); rest != "" && w.stream.Subscribed() {
+		w.stream.publish(rest, time.Now())
+	}
+	w.buf.Reset()
+	return w.WriteCloser.Close()
+}
+
+// RunLogStream handles subscribe_log and unsubscribe_log through all of the app lifetime.
+// It should be called before other method handlers to take precedence over RunNotImplemented.
+func RunLogStream() (cancelFunc func()) {
+	var callback js.Func
+	cancelFunc = func() {
+		js.Global().Get("self").Call("removeEventListener", "message", callback)
+		callback.Release()
+		theLogStream.Unsubscribe()
+	}
+	callback = js.FuncOf(func(this js.Value, args []js.Value) any {
+		data := args[0].Get("data")
+		switch methodName := data.Index(0).String(); methodName {
+		case "subscribe_log":
+			ConsumeMessageEvent(args[0])
+			theLogStream.Subscribe()
+			SendBackMethodOK(methodName)
+		case "unsubscribe_log":
+			ConsumeMessageEvent(args[0])
+			theLogStream.Unsubscribe()
+			SendBackMethodOK(methodName)
+		}
+		return nil
+	})
+	js.Global().Get("self").Call("addEventListener", "message", callback, false)
+	return
+}
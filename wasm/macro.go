@@ -0,0 +1,346 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mzki/erago-wasm/paratext"
+)
+
+const (
+	// macroFile stores macro definitions under the package root.
+	macroFile = ".erago-wasm-macros.json"
+	// DefaultMacroMaxIterations is the default safety limit of iterations of a running macro.
+	DefaultMacroMaxIterations = 1000
+	// macroOutputLimit is the max bytes of output text kept for conditions.
+	macroOutputLimit = 64 * 1024
+)
+
+// Macro is a named sequence of commands. The sequence is repeated Repeat times,
+// or until stopped when Repeat is zero, but never over the iteration limit.
+type Macro struct {
+	Name   string      `json:"name"`
+	Steps  []MacroStep `json:"steps"`
+	Repeat int         `json:"repeat,omitempty"`
+	// StopIf is a regular expression. The macro stops when output text matches it.
+	StopIf string `json:"stopIf,omitempty"`
+}
+
+// MacroStep is a command of Macro. Output text for conditions is the text of paragraphs
+// published since the last command sent by the macro.
+type MacroStep struct {
+	Command string `json:"command"`
+	WaitMs  int    `json:"waitMs,omitempty"` // wait before sending the command.
+	// If is a regular expression. The step is skipped unless output text matches it.
+	// When no step matches, the macro waits for the next command request with more output.
+	If string `json:"if,omitempty"`
+}
+
+// ParseMacro parses JSON of Macro and validates it.
+func ParseMacro(bs []byte) (*Macro, error) {
+	m := &Macro{}
+	if err := json.Unmarshal(bs, m); err != nil {
+		return nil, fmt.Errorf("invalid macro: %w", err)
+	}
+	if _, err := m.compile(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// compiledMacro is Macro with compiled regular expressions.
+type compiledMacro struct {
+	*Macro
+	stopIf *regexp.Regexp   // nil if not set.
+	ifs    []*regexp.Regexp // nil element if not set.
+}
+
+func (m *Macro) compile() (*compiledMacro, error) {
+	if m.Name == "" {
+		return nil, fmt.Errorf("macro name is empty")
+	}
+	if len(m.Steps) == 0 {
+		return nil, fmt.Errorf("macro %s has no steps", m.Name)
+	}
+	if m.Repeat < 0 {
+		return nil, fmt.Errorf("macro %s: repeat must not be negative", m.Name)
+	}
+	cm := &compiledMacro{Macro: m, ifs: make([]*regexp.Regexp, len(m.Steps))}
+	var err error
+	if m.StopIf != "" {
+		if cm.stopIf, err = regexp.Compile(m.StopIf); err != nil {
+			return nil, fmt.Errorf("macro %s: stopIf: %w", m.Name, err)
+		}
+	}
+	for i, step := range m.Steps {
+		if step.WaitMs < 0 {
+			return nil, fmt.Errorf("macro %s: step %d: waitMs must not be negative", m.Name, i)
+		}
+		if step.If != "" {
+			if cm.ifs[i], err = regexp.Compile(step.If); err != nil {
+				return nil, fmt.Errorf("macro %s: step %d: if: %w", m.Name, i, err)
+			}
+		}
+	}
+	return cm, nil
+}
+
+// macroStore is persistent macro definitions of a package.
+type macroStore struct {
+	fsys *WebFileSystem // package root.
+
+	mu     sync.Mutex
+	macros []*Macro // ordered by name.
+}
+
+// newMacroStore loads macros from fsys. Broken macro file is discarded.
+func newMacroStore(fsys *WebFileSystem) *macroStore {
+	s := &macroStore{fsys: fsys}
+	if !fsys.Exist(macroFile) {
+		return s
+	}
+	content, err := readAllFile(fsys, macroFile)
+	if err == nil {
+		err = json.Unmarshal(content, &s.macros)
+	}
+	if err != nil {
+		fmt.Printf("macro: discard broken macros: %v\n", err)
+		s.macros = nil
+	}
+	slices.SortFunc(s.macros, func(a, b *Macro) int { return strings.Compare(a.Name, b.Name) })
+	return s
+}
+
+func (s *macroStore) persistLocked() error {
+	content, err := json.Marshal(s.macros)
+	if err != nil {
+		return err
+	}
+	return writeAllFile(s.fsys, macroFile, content)
+}
+
+// Define adds macro or replaces the one with the same name.
+func (s *macroStore) Define(m *Macro) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, found := slices.BinarySearchFunc(s.macros, m.Name, func(e *Macro, name string) int { return strings.Compare(e.Name, name) })
+	if found {
+		s.macros[i] = m
+	} else {
+		s.macros = slices.Insert(s.macros, i, m)
+	}
+	return s.persistLocked()
+}
+
+// Delete removes macro by name.
+func (s *macroStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.macros, func(e *Macro) bool { return e.Name == name })
+	if i < 0 {
+		return fmt.Errorf("macro %s is not defined", name)
+	}
+	s.macros = slices.Delete(s.macros, i, i+1)
+	return s.persistLocked()
+}
+
+func (s *macroStore) Get(name string) (*Macro, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.macros, func(e *Macro) bool { return e.Name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("macro %s is not defined", name)
+	}
+	return s.macros[i], nil
+}
+
+// MarshalList returns JSON of all macros.
+func (s *macroStore) MarshalList() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.macros == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s.macros)
+}
+
+// Reasons why running macro stops, sent by macroStatus message.
+const (
+	MacroStopCompleted      = "completed"
+	MacroStopStopped        = "stopped" // by stop_macro.
+	MacroStopCondition      = "stopCondition"
+	MacroStopIterationLimit = "iterationLimit"
+	MacroStopEngineQuit     = "engineQuit"
+)
+
+var errMacroRunning = errors.New("another macro is running")
+
+// macroRunner runs a macro by sending its commands whenever the engine requests command.
+type macroRunner struct {
+	maxIterations int
+	encoding      int
+	send          func(command string)
+
+	mu        sync.Mutex
+	macro     *compiledMacro // nil if not running.
+	runID     int
+	iteration int
+	step      int
+	output    strings.Builder
+	cancel    chan struct{} // closed when the run stops, to cancel waiting.
+}
+
+func newMacroRunner(maxIterations int, encoding int, send func(command string)) *macroRunner {
+	if maxIterations <= 0 {
+		maxIterations = DefaultMacroMaxIterations
+	}
+	return &macroRunner{maxIterations: maxIterations, encoding: encoding, send: send}
+}
+
+// Start starts running m. The first command is sent at the next command request,
+// or immediately if waitingCommand is true.
+func (r *macroRunner) Start(m *Macro, waitingCommand bool) error {
+	cm, err := m.compile()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.macro != nil {
+		return errMacroRunning
+	}
+	r.macro = cm
+	r.runID += 1
+	r.iteration, r.step = 0, 0
+	r.output.Reset()
+	r.cancel = make(chan struct{})
+	SendBackMacroStatus(cm.Name, true, r.iteration, "")
+	if waitingCommand {
+		r.nextLocked()
+	}
+	return nil
+}
+
+// Stop stops running macro with reason. It does nothing if not running.
+func (r *macroRunner) Stop(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked(reason)
+}
+
+func (r *macroRunner) stopLocked(reason string) {
+	if r.macro == nil {
+		return
+	}
+	SendBackMacroStatus(r.macro.Name, false, r.iteration, reason)
+	close(r.cancel)
+	r.macro = nil
+}
+
+// RecordOutput records fixed paragraph for conditions.
+func (r *macroRunner) RecordOutput(bs []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.macro == nil {
+		return
+	}
+	text, err := paratext.Decode(bs, r.encoding)
+	if err != nil {
+		fmt.Printf("macro: %v\n", err)
+		return
+	}
+	r.output.WriteString(text)
+	r.output.WriteString("\n")
+	if r.output.Len() > macroOutputLimit {
+		tail := r.output.String()[r.output.Len()-macroOutputLimit/2:]
+		r.output.Reset()
+		r.output.WriteString(tail)
+	}
+}
+
+// OnCommandRequested sends next command of running macro.
+func (r *macroRunner) OnCommandRequested() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextLocked()
+}
+
+func (r *macroRunner) nextLocked() {
+	m := r.macro
+	if m == nil {
+		return
+	}
+	output := r.output.String()
+	if m.stopIf != nil && m.stopIf.MatchString(output) {
+		r.stopLocked(MacroStopCondition)
+		return
+	}
+	if r.step >= len(m.Steps) && !r.completeIterationLocked() {
+		return
+	}
+	// find the next step matching output within one cycle of steps.
+	next := -1
+	for n := 0; n < len(m.Steps); n++ {
+		i := (r.step + n) % len(m.Steps)
+		if cond := m.ifs[i]; cond == nil || cond.MatchString(output) {
+			next = i
+			break
+		}
+	}
+	if next < 0 {
+		// keep output, so that conditions see it together with output of the next prompt,
+		// e.g. after the user inputs a command manually.
+		return
+	}
+	if next < r.step && !r.completeIterationLocked() {
+		return
+	}
+	step := m.Steps[next]
+	r.step = next + 1
+	r.output.Reset()
+
+	runID, cancel := r.runID, r.cancel
+	// send in another goroutine since this is called from the engine.
+	GoRecover("run_macro", func() {
+		if step.WaitMs > 0 {
+			select {
+			case <-time.After(time.Duration(step.WaitMs) * time.Millisecond):
+			case <-cancel:
+				return
+			}
+		}
+		r.mu.Lock()
+		running := r.macro != nil && r.runID == runID
+		r.mu.Unlock()
+		if running {
+			r.send(step.Command)
+		}
+	})
+}
+
+// completeIterationLocked counts up iteration and rewinds to the first step.
+// It returns false when the macro is stopped by reaching Repeat or the iteration limit.
+func (r *macroRunner) completeIterationLocked() bool {
+	m := r.macro
+	r.iteration += 1
+	switch {
+	case m.Repeat > 0 && r.iteration >= m.Repeat:
+		r.stopLocked(MacroStopCompleted)
+		return false
+	case r.iteration >= r.maxIterations:
+		r.stopLocked(MacroStopIterationLimit)
+		return false
+	}
+	r.step = 0
+	SendBackMacroStatus(m.Name, true, r.iteration, "")
+	return true
+}
@@ -6,7 +6,10 @@ package main
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"syscall/js"
+
+	"github.com/mzki/erago/app"
 )
 
 var (
@@ -19,6 +22,7 @@ func main() {
 	fmt.Printf("---------- Start %s-%s-%s ----------\n", APPNAME, VERSION, COMMIT_HASH)
 	SendBackStatusAppLaunchOK()
 	defer func() {
+		theEngineState.SetPhase(PhaseShutdown)
 		fmt.Printf("---------- End %s-%s-%s ----------\n", APPNAME, VERSION, COMMIT_HASH)
 		SendBackStatusAppShutdown()
 	}()
@@ -26,11 +30,33 @@ func main() {
 	const rootDir = "/erago-wasm"
 	store := NewWebFilesystem(rootDir)
 
+	SetupCrashReporter(store)
+	// report panic before appShutdown is sent.
+	defer RecoverCrash("main")
+
+	cancelLogStream := RunLogStream()
+	defer cancelLogStream()
+	cancelStateQuery := RunEngineStateQuery()
+	defer cancelStateQuery()
+
+	// engine can be initialized again after quit, without reloading wasm module.
+	// the loop ends only when shutdown_app is requested.
+	for runEngineLifetime(store, rootDir) {
+		SendBackStatusEngineQuit()
+	}
+}
+
+// runEngineLifetime waits for engine initialization, runs the engine until it quits, then
+// tears down the engine state and message handlers so that next lifetime can start cleanly.
+// It returns false when app shutdown is requested instead of engine initialization.
+func runEngineLifetime(store *WebFileSystem, rootDir string) bool {
 	var initResult engineInitResult
 	{
 		initResultCh, cancelInitEngine := AwaitInitEngineWithPath(store, rootDir)
 		cancelRunPkg := RunPackager(store, rootDir)
 		cancelNotImpl := RunNotImplemented()
+		theEngineState.SetEngine("", nil)
+		theEngineState.SetPhase(PhaseWaitForEngineInit)
 		SendBackStatusWaitForEngineInit()
 
 		initResult = <-initResultCh
@@ -39,10 +65,26 @@ func main() {
 		cancelRunPkg()
 		cancelNotImpl()
 	}
+	if initResult.shutdown {
+		return false
+	}
+	theCrashReporter.ClearParagraphs() // paragraphs of previous engine are irrelevant.
+	theEngineState.SetEngine(initResult.rootPath, &initResult.options)
+	theEngineState.SetPhase(PhaseEngineInitialized)
+	defer initResult.messenger.transcript.Close() // after quit, engine no longer publishes.
+	defer func() {
+		if recorder := initResult.messenger.recorder; recorder != nil {
+			if err := recorder.Persist(); err != nil {
+				fmt.Printf("failed to persist session record: %v\n", err)
+			}
+		}
+	}()
 	defer initResult.quitFunc()
+	defer initResult.messenger.flow.Close() // release engine blocked by flow control before quit.
 
-	waitRunEngine := AwaitRunEngine()
-	cancelRunIO := RunIO()
+	waitRunEngine, cancelAwaitRunEngine := AwaitRunEngine()
+	defer cancelAwaitRunEngine()
+	cancelRunIO := RunIO(initResult.messenger, initResult.history, initResult.macros)
 	defer cancelRunIO()
 	cancelNotImpl := RunNotImplemented()
 	defer cancelNotImpl()
@@ -50,15 +92,21 @@ func main() {
 
 	<-waitRunEngine
 	RunEngine(initResult.messenger)
+	theEngineState.SetPhase(PhaseEngineRunning)
 	SendBackStatusEngineStartOK()
 
 	<-initResult.messenger.Done()
+	return true
 }
 
 type engineInitResult struct {
 	messenger *uiMessenger
+	history   *commandHistory
+	macros    *macroStore
 	quitFunc  func()
 	rootPath  string
+	options   EngineOptions
+	shutdown  bool // app shutdown is requested instead of engine initialization.
 }
 
 func AwaitInitEngineWithPath(
@@ -89,24 +137,46 @@ func AwaitInitEngineWithPath(
 			}
 			opt := ParseEngineOptions(data.Index(2))
 			fmt.Printf("EngineOptions: %v\n", opt)
-			go func() { // to avoid blocking js eventLoop
-				rootPathStore, err := store.Sub(rootPath, false)
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				initResult, err := initEngineWithPath(store, rootPath, opt, nil)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				messenger, quitFunc, err := InitEngine(rootPath, rootPathStore, opt)
+				result <- initResult
+				SendBackMethodOK(methodName)
+			})
+		case "replay_session":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			if !strings.HasPrefix(rootPath, rootDir) {
+				SendBackMethodError(methodName, fmt.Errorf("selected path(%s) should be under %s", rootPath, rootDir))
+				return nil
+			}
+			recordBs := ToGoBytes(data.Index(2))
+			opt := ParseEngineOptions(data.Index(3))
+			// replay is not recorded again.
+			opt.RecordSession = false
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				record, err := ParseSessionRecord(recordBs)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				result <- engineInitResult{
-					messenger: messenger,
-					quitFunc:  quitFunc,
-					rootPath:  rootPath,
+				initResult, err := initEngineWithPath(store, rootPath, opt, record)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
 				}
+				result <- initResult
 				SendBackMethodOK(methodName)
-			}()
+			})
+		case "shutdown_app":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				result <- engineInitResult{shutdown: true}
+				SendBackMethodOK(methodName)
+			})
 		}
 		return nil
 	})
@@ -114,30 +184,74 @@ func AwaitInitEngineWithPath(
 	return
 }
 
-func AwaitRunEngine() <-chan struct{} {
+// initEngineWithPath initializes engine with package at rootPath. When replayRecord is not nil,
+// the engine replays the recorded session.
+func initEngineWithPath(store *WebFileSystem, rootPath string, opt EngineOptions, replayRecord *SessionRecord) (engineInitResult, error) {
+	rootPathStore, err := store.Sub(rootPath, false)
+	if err != nil {
+		return engineInitResult{}, err
+	}
+	backupStore, err := NewSaveBackupFileSystem(rootPathStore, opt.SaveBackupCount)
+	if err != nil {
+		return engineInitResult{}, err
+	}
+	currentSaveBackupCount = opt.SaveBackupCount
+	rotateStore := NewRotatingLogFileSystem(backupStore, rootPathStore, app.DefaultLogFile, opt.LogRotate)
+	logStore := NewLogStreamFileSystem(rotateStore, rootPath, app.DefaultLogFile)
+
+	// random source is seeded here, so these should be created just before engine initialization.
+	var recorder *sessionRecorder
+	var replayer *sessionReplayer
+	if replayRecord != nil {
+		replayer = newSessionReplayer(replayRecord, opt.MessageByteEncoding)
+	} else if opt.RecordSession {
+		recorder = newSessionRecorder(rootPathStore, rootPath, opt.MessageByteEncoding)
+	}
+	transcript := newTranscriptWriter(rootPathStore, opt.MessageByteEncoding, opt.RecordTranscript)
+	messenger := newUiMessenger(opt, transcript, recorder, replayer)
+	quitFunc, err := InitEngine(rootPath, logStore, messenger, opt)
+	if err != nil {
+		transcript.Close()
+		return engineInitResult{}, err
+	}
+	return engineInitResult{
+		messenger: messenger,
+		history:   newCommandHistory(rootPathStore, opt.CommandHistorySize),
+		macros:    newMacroStore(rootPathStore),
+		quitFunc:  quitFunc,
+		rootPath:  rootPath,
+		options:   opt,
+	}, nil
+}
+
+func AwaitRunEngine() (runEngineChan <-chan struct{}, cancelFunc func()) {
 	runEngine := make(chan struct{})
+	runEngineChan = runEngine
 
 	var callback js.Func
-	cancelFunc := func() {
-		js.Global().Get("self").Call("removeEventListener", "message", callback)
-		callback.Release()
-		close(runEngine)
+	var cancelOnce sync.Once
+	cancelFunc = func() {
+		cancelOnce.Do(func() {
+			js.Global().Get("self").Call("removeEventListener", "message", callback)
+			callback.Release()
+			close(runEngine)
+		})
 	}
 	callback = js.FuncOf(func(this js.Value, args []js.Value) any {
 		data := args[0].Get("data")
 		switch methodName := data.Index(0).String(); methodName {
 		case "start_engine":
 			ConsumeMessageEvent(args[0])
-			go func() {
+			GoRecover(methodName, func() {
 				runEngine <- struct{}{}
 				SendBackMethodOK(methodName)
 				cancelFunc()
-			}()
+			})
 		}
 		return nil
 	})
 	js.Global().Get("self").Call("addEventListener", "message", callback, false)
-	return runEngine
+	return
 }
 
 func RunNotImplemented() (cancelFunc func()) {
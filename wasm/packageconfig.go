@@ -0,0 +1,52 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/mzki/erago/app"
+	"github.com/mzki/erago/infra/serialize/toml"
+)
+
+// LoadPackageConfig reads erago config file in the package root of pkgFsys.
+// Unlike app.LoadConfigOrDefault, it never writes default config file when the file is not found,
+// and returns default config with app.ErrDefaultConfigGenerated instead.
+func LoadPackageConfig(pkgFsys *WebFileSystem) (*app.Config, error) {
+	appConf := app.NewConfig(app.DefaultBaseDir)
+	if !pkgFsys.Exist(app.ConfigFile) {
+		return appConf, app.ErrDefaultConfigGenerated
+	}
+	r, err := pkgFsys.Load(app.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if err := toml.Decode(r, appConf); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", app.ConfigFile, err)
+	}
+	return appConf, nil
+}
+
+// packageRuntimeDirs returns directories which are written by engine at runtime, such as save directory.
+func packageRuntimeDirs(appConf *app.Config) []string {
+	return []string{
+		filepath.Clean(appConf.Game.RepoConfig.SaveFileDir),
+		saveBackupDir,
+		logRotateDir,
+		sessionRecordDir,
+	}
+}
+
+// packageRuntimeFiles returns files which are written by engine at runtime, such as log file.
+func packageRuntimeFiles() []string {
+	// mobile model always uses default log file.
+	return []string{
+		app.DefaultLogFile,
+		transcriptFile,
+		commandHistoryFile,
+		macroFile,
+	}
+}
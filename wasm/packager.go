@@ -14,7 +14,14 @@ import (
 func RunPackager(fsys *WebFileSystem, rootPath string) (cancelFunc func()) {
 	pkgCallbacks := js.FuncOf(func(this js.Value, args []js.Value) any {
 		data := args[0].Get("data")
+		limits := currentArchiveLimits // copy to be used in goroutine.
 		switch methodName := data.Index(0).String(); methodName {
+		case "set_archive_limits":
+			ConsumeMessageEvent(args[0])
+			// no lock needed since this callback is called in js eventLoop sequentially.
+			currentArchiveLimits = ParseArchiveLimits(DefaultArchiveLimits, data.Index(1))
+			SendBackMethodOK(methodName)
+
 		case "install_package":
 			ConsumeMessageEvent(args[0])
 			bs := ToGoBytes(data.Index(1))
@@ -24,104 +31,358 @@ func RunPackager(fsys *WebFileSystem, rootPath string) (cancelFunc func()) {
 			} else {
 				baseName = data.Index(2).String()
 			}
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				subFSys, err := fsys.Sub(baseName, true)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				extractedDir, err := model.InstallPackage(subFSys, bs)
+				extractedDir, err := InstallPackageWithIntegrity(subFSys, bs, limits)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
 				installedPath := filepath.Join(rootPath, baseName, extractedDir)
 				SendBackInstalledPath(methodName, installedPath)
-			}()
+			})
+
+		case "upgrade_package":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			bs := ToGoBytes(data.Index(2))
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				installedPath, err := UpgradePackage(fsys, rootPath, bs, limits)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackInstalledPath(methodName, installedPath)
+			})
+
+		case "apply_patch":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			bs := ToGoBytes(data.Index(2))
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				record, err := ApplyPatch(fsys, rootPath, bs, limits)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackPatchRecord(methodName, record)
+			})
+
+		case "revert_patch":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				record, err := RevertPatch(fsys, rootPath)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackPatchRecord(methodName, record)
+			})
 
 		case "uninstall_package":
 			ConsumeMessageEvent(args[0])
 			fpath := data.Index(1).String()
-			go func() { // to avoid blocking js eventLoop
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				if err := fsys.Remove(fpath); err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
 				SendBackMethodOK(methodName)
-			}()
+			})
 
 		case "validate_package":
 			ConsumeMessageEvent(args[0])
 			rootPath := data.Index(1).String()
 			confPath := filepath.Join(rootPath, app.ConfigFile)
-			go func() { // to avoid blocking js eventLoop
+			deep := false
+			if opt := data.Index(2); opt.Type() == js.TypeObject {
+				deep = opt.Get("deep").Truthy()
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if deep {
+					report, err := ValidatePackageDeep(fsys, rootPath)
+					if err != nil {
+						SendBackMethodError(methodName, err)
+						return
+					}
+					SendBackPackageReport(methodName, report)
+					return
+				}
 				if fsys.ExistDir(rootPath) && fsys.Exist(confPath) {
 					SendBackMethodOK(methodName)
 				} else {
 					SendBackMethodNG(methodName)
 				}
-			}()
+			})
 
-		case "exportsav":
+		case "verify_package":
 			ConsumeMessageEvent(args[0])
 			rootPath := data.Index(1).String()
-			go func() { // to avoid blocking js eventLoop
-				subFsys, err := fsys.Sub(rootPath, false)
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				report, err := VerifyPackage(fsys, rootPath)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				savBs, err := model.ExportSav(rootPath, subFsys)
+				SendBackIntegrityReport(methodName, report)
+			})
+
+		case "exportsav":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				savBs, err := ExportSaves(fsys, rootPath)
 				if err != nil {
-					if model.IsExportFileNotFound(err) {
-						savBs = []byte{} // suceeded with empty bytes.
-					} else {
-						SendBackMethodError(methodName, err)
-						return
-					}
+					SendBackMethodError(methodName, err)
+					return
 				}
 				jsBs := ToJsBytes(savBs)
 				SendBackSavZipBytes(methodName, jsBs)
-			}()
+			})
 
 		case "importsav":
 			ConsumeMessageEvent(args[0])
 			rootPath := data.Index(1).String()
-			go func() { // to avoid blocking js eventLoop
+			// options are optional. without options, all save files are overwritten by model.ImportSav.
+			opt := data.Index(3)
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
 				bs := ToGoBytes(data.Index(2))
+				if opt.Type() == js.TypeObject {
+					var policyName string
+					if v := opt.Get("policy"); !v.IsUndefined() {
+						policyName = v.String()
+					}
+					policy, err := ParseSaveMergePolicy(policyName)
+					if err != nil {
+						SendBackMethodError(methodName, err)
+						return
+					}
+					result, err := ImportSavesMerged(fsys, rootPath, bs, policy, opt.Get("dryRun").Truthy(), limits)
+					if err != nil {
+						SendBackMethodError(methodName, err)
+						return
+					}
+					SendBackSaveImportResult(methodName, result)
+					return
+				}
 				subFsys, err := fsys.Sub(rootPath, false)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				if err := model.ImportSav(rootPath, subFsys, bs); err != nil {
+				if err := limits.CheckZip(bs); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				if err := model.ImportSav(rootPath, NewLimitFileSystem(subFsys, limits), bs); err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
 				SendBackMethodOK(methodName)
-			}()
+			})
 
-		case "exportlog":
+		case "list_saves":
 			ConsumeMessageEvent(args[0])
 			rootPath := data.Index(1).String()
-			go func() { // to avoid blocking js eventLoop
-				subFsys, err := fsys.Sub(rootPath, false)
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				infos, err := ListSaves(fsys, rootPath)
 				if err != nil {
 					SendBackMethodError(methodName, err)
 					return
 				}
-				logBs, err := model.ExportLog(rootPath, subFsys)
+				SendBackSaveSlots(methodName, infos)
+			})
+
+		case "export_save_slot":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			slot := data.Index(2).Int()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				savBs, err := ExportSaveSlot(fsys, rootPath, slot)
 				if err != nil {
-					if model.IsExportFileNotFound(err) {
-						logBs = []byte{} // suceeded with empty bytes.
-					} else {
-						SendBackMethodError(methodName, err)
-						return
-					}
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackSaveBytes(methodName, ToJsBytes(savBs))
+			})
+
+		case "import_save_slot":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			slot := data.Index(2).Int()
+			bs := ToGoBytes(data.Index(3))
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := ImportSaveSlot(fsys, rootPath, slot, bs); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "delete_save_slot":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			slot := data.Index(2).Int()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := DeleteSaveSlot(fsys, rootPath, slot); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "copy_save_slot":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			from := data.Index(2).Int()
+			to := data.Index(3).Int()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := CopySaveSlot(fsys, rootPath, from, to); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "list_save_backups":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			slot := data.Index(2).Int()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				infos, err := ListSaveBackups(fsys, rootPath, slot)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackSaveBackups(methodName, infos)
+			})
+
+		case "restore_save_backup":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			slot := data.Index(2).Int()
+			backupID := data.Index(3).String()
+			keep := currentSaveBackupCount
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := RestoreSaveBackup(fsys, rootPath, slot, backupID, keep); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "export_crash_reports":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				zipBs, err := ExportCrashReports(fsys)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackCrashReportsZipBytes(methodName, ToJsBytes(zipBs))
+			})
+
+		case "clear_crash_reports":
+			ConsumeMessageEvent(args[0])
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				if err := ClearCrashReports(fsys); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackMethodOK(methodName)
+			})
+
+		case "exportlog":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				// mobile model always uses default log file.
+				logBs, err := ExportLogZip(fsys, rootPath, app.DefaultLogFile)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
 				}
 				jsBs := ToJsBytes(logBs)
 				SendBackLogBytes(methodName, jsBs)
-			}()
+			})
+
+		case "export_transcript":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			var formatStr string
+			if v := data.Index(2); v.Type() == js.TypeString {
+				formatStr = v.String()
+			}
+			format, err := ParseTranscriptFormat(formatStr)
+			if err != nil {
+				SendBackMethodError(methodName, err)
+				return nil
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				bs, err := ExportTranscript(fsys, rootPath, format)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackTranscriptBytes(methodName, ToJsBytes(bs))
+			})
+
+		case "export_sessions":
+			ConsumeMessageEvent(args[0])
+			rootPath := data.Index(1).String()
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				zipBs, err := ExportSessionRecords(fsys, rootPath)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackSessionRecordBytes(methodName, ToJsBytes(zipBs))
+			})
+
+		case "export_all":
+			ConsumeMessageEvent(args[0])
+			var packages []string
+			if v := data.Index(1); !v.IsUndefined() && !v.IsNull() {
+				packages = ToGoStrings(v)
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				zipBs, err := ExportAll(fsys, packages)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackBackupZipBytes(methodName, ToJsBytes(zipBs))
+			})
+
+		case "import_all":
+			ConsumeMessageEvent(args[0])
+			bs := ToGoBytes(data.Index(1))
+			var policyName string
+			if v := data.Index(2); !v.IsUndefined() {
+				policyName = v.String()
+			}
+			GoRecover(methodName, func() { // to avoid blocking js eventLoop
+				policy, err := ParseConflictPolicy(policyName)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				if err := limits.CheckZip(bs); err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				restored, err := ImportAll(fsys, bs, policy)
+				if err != nil {
+					SendBackMethodError(methodName, err)
+					return
+				}
+				SendBackRestoredPackages(methodName, restored)
+			})
 
 		}
 		return nil
@@ -0,0 +1,291 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// patchRootDir stores backups of files replaced by patches, under the package root.
+	patchRootDir = ".erago-wasm-patches"
+	// patchRecordFile is stored in each patch directory.
+	patchRecordFile = "patch.json"
+	// patchBackupDir stores original files in each patch directory.
+	patchBackupDir = "backup"
+)
+
+var (
+	ErrNoPatchApplied   = errors.New("no patch applied")
+	ErrPatchEmpty       = errors.New("patch contains no files")
+	ErrPatchInvalidPath = errors.New("patch contains invalid path")
+)
+
+// PatchRecord describes a patch applied by ApplyPatch. Paths are slash separated and relative to the package root.
+type PatchRecord struct {
+	ID        string    `json:"id"`
+	AppliedAt time.Time `json:"appliedAt"`
+	Replaced  []string  `json:"replaced"`
+	Added     []string  `json:"added"`
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *PatchRecord) ToJsValue() map[string]any {
+	return map[string]any{
+		"id":       r.ID,
+		"replaced": stringsToAny(r.Replaced),
+		"added":    stringsToAny(r.Added),
+	}
+}
+
+// ApplyPatch extracts archive over the installed package at rootPath.
+// The archive can be any format supported by NormalizePackageArchive, and is extracted within limits.
+// Files in the archive are relative to the package root. If all of files are under a directory
+// having the same name as the package root, the directory is stripped.
+// Replaced files are kept as backup so that RevertPatch can restore them.
+func ApplyPatch(fsys *WebFileSystem, rootPath string, archiveBytes []byte, limits ArchiveLimits) (*PatchRecord, error) {
+	pkgFsys, err := fsys.Sub(rootPath, false)
+	if err != nil {
+		return nil, err
+	}
+	zipBytes, err := NormalizePackageArchive(archiveBytes, limits)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.CheckZip(zipBytes); err != nil {
+		return nil, err
+	}
+	zReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, err
+	}
+	zFiles, err := patchTargetFiles(zReader, filepath.Base(rootPath))
+	if err != nil {
+		return nil, err
+	}
+
+	patchIDs, err := listPatchIDs(pkgFsys)
+	if err != nil {
+		return nil, err
+	}
+	record := &PatchRecord{
+		ID:        fmt.Sprintf("%04d", len(patchIDs)+1),
+		AppliedAt: time.Now(),
+		Replaced:  []string{},
+		Added:     []string{},
+	}
+	patchDir := filepath.Join(patchRootDir, record.ID)
+
+	// backup first, so that failure in the middle of extraction can be reverted.
+	if err := backupPatchTargets(pkgFsys, patchDir, zFiles, record); err != nil {
+		// incomplete patch directory without record breaks RevertPatch and numbering of IDs.
+		if pkgFsys.ExistDir(patchDir) {
+			if removeErr := pkgFsys.Remove(patchDir); removeErr != nil {
+				return nil, errors.Join(err, removeErr)
+			}
+		}
+		return nil, err
+	}
+
+	// extract
+	entries := make([]IntegrityFileEntry, 0, len(zFiles))
+	for _, path := range append(slices.Clone(record.Replaced), record.Added...) {
+		content, err := readAllZipFile(zFiles[path])
+		if err == nil {
+			err = writeAllFile(pkgFsys, filepath.FromSlash(path), content)
+		}
+		if err != nil {
+			if revertErr := revertPatch(pkgFsys, record); revertErr != nil {
+				return nil, errors.Join(err, revertErr)
+			}
+			return nil, fmt.Errorf("failed to patch %s: %w", path, err)
+		}
+		entries = append(entries, IntegrityFileEntry{Path: path, Size: int64(len(content)), SHA256: sha256Hex(content)})
+	}
+	if err := updateIntegrityManifest(pkgFsys, entries); err != nil {
+		return record, fmt.Errorf("patch applied but failed to update integrity manifest: %w", err)
+	}
+	return record, nil
+}
+
+// backupPatchTargets stores original files replaced by zFiles and the integrity manifest into patchDir,
+// and writes record completed with replaced and added files.
+func backupPatchTargets(pkgFsys *WebFileSystem, patchDir string, zFiles map[string]*zip.File, record *PatchRecord) error {
+	for _, path := range slices.Sorted(maps.Keys(zFiles)) {
+		fpath := filepath.FromSlash(path)
+		if pkgFsys.Exist(fpath) {
+			content, err := readAllFile(pkgFsys, fpath)
+			if err != nil {
+				return err
+			}
+			if err := writeAllFile(pkgFsys, filepath.Join(patchDir, patchBackupDir, fpath), content); err != nil {
+				return fmt.Errorf("failed to backup %s: %w", path, err)
+			}
+			record.Replaced = append(record.Replaced, path)
+		} else {
+			record.Added = append(record.Added, path)
+		}
+	}
+	if pkgFsys.Exist(IntegrityManifestFile) {
+		content, err := readAllFile(pkgFsys, IntegrityManifestFile)
+		if err != nil {
+			return err
+		}
+		if err := writeAllFile(pkgFsys, filepath.Join(patchDir, IntegrityManifestFile), content); err != nil {
+			return err
+		}
+	}
+	return writePatchRecord(pkgFsys, patchDir, record)
+}
+
+// RevertPatch restores files replaced by the latest patch applied to the package at rootPath,
+// and removes files added by the patch. It returns the reverted patch.
+func RevertPatch(fsys *WebFileSystem, rootPath string) (*PatchRecord, error) {
+	pkgFsys, err := fsys.Sub(rootPath, false)
+	if err != nil {
+		return nil, err
+	}
+	patchIDs, err := listPatchIDs(pkgFsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(patchIDs) == 0 {
+		return nil, ErrNoPatchApplied
+	}
+	patchDir := filepath.Join(patchRootDir, patchIDs[len(patchIDs)-1])
+	bs, err := readAllFile(pkgFsys, filepath.Join(patchDir, patchRecordFile))
+	if err != nil {
+		return nil, err
+	}
+	record := &PatchRecord{}
+	if err := json.Unmarshal(bs, record); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", patchRecordFile, err)
+	}
+	if err := revertPatch(pkgFsys, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func revertPatch(pkgFsys *WebFileSystem, record *PatchRecord) error {
+	patchDir := filepath.Join(patchRootDir, record.ID)
+	for _, path := range record.Replaced {
+		fpath := filepath.FromSlash(path)
+		content, err := readAllFile(pkgFsys, filepath.Join(patchDir, patchBackupDir, fpath))
+		if err != nil {
+			return fmt.Errorf("failed to read backup of %s: %w", path, err)
+		}
+		if err := writeAllFile(pkgFsys, fpath, content); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+	for _, path := range record.Added {
+		if fpath := filepath.FromSlash(path); pkgFsys.Exist(fpath) {
+			if err := pkgFsys.Remove(fpath); err != nil {
+				return err
+			}
+		}
+	}
+	if manifestPath := filepath.Join(patchDir, IntegrityManifestFile); pkgFsys.Exist(manifestPath) {
+		content, err := readAllFile(pkgFsys, manifestPath)
+		if err != nil {
+			return err
+		}
+		if err := writeAllFile(pkgFsys, IntegrityManifestFile, content); err != nil {
+			return err
+		}
+	}
+	return pkgFsys.Remove(patchDir)
+}
+
+// patchTargetFiles returns zip files indexed by the path relative to the package root.
+func patchTargetFiles(zReader *zip.Reader, pkgName string) (map[string]*zip.File, error) {
+	files := make([]*zip.File, 0, len(zReader.File))
+	for _, zf := range zReader.File {
+		if !zf.FileInfo().IsDir() {
+			files = append(files, zf)
+		}
+	}
+	if len(files) == 0 {
+		return nil, ErrPatchEmpty
+	}
+	stripPrefix := pkgName + "/"
+	for _, zf := range files {
+		if !strings.HasPrefix(zf.Name, stripPrefix) {
+			stripPrefix = ""
+			break
+		}
+	}
+
+	zFiles := make(map[string]*zip.File, len(files))
+	for _, zf := range files {
+		if zf.NonUTF8 {
+			return nil, fmt.Errorf("zip archive containing non-UTF8 file name, is not allowed: file name: %v", zf.Name)
+		}
+		path := strings.TrimPrefix(zf.Name, stripPrefix)
+		fpath := filepath.FromSlash(path)
+		if !filepath.IsLocal(fpath) {
+			return nil, fmt.Errorf("%w: %s", ErrPatchInvalidPath, zf.Name)
+		}
+		if fpath == IntegrityManifestFile || strings.HasPrefix(fpath, patchRootDir) {
+			return nil, fmt.Errorf("%w: reserved path %s", ErrPatchInvalidPath, zf.Name)
+		}
+		zFiles[path] = zf
+	}
+	return zFiles, nil
+}
+
+// listPatchIDs returns IDs of applied patches in applied order.
+func listPatchIDs(pkgFsys *WebFileSystem) ([]string, error) {
+	if !pkgFsys.ExistDir(patchRootDir) {
+		return []string{}, nil
+	}
+	entries, err := pkgFsys.ReadDir(patchRootDir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir {
+			ids = append(ids, entry.Name) // already sorted by name.
+		}
+	}
+	return ids, nil
+}
+
+func writePatchRecord(pkgFsys *WebFileSystem, patchDir string, record *PatchRecord) error {
+	bs, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAllFile(pkgFsys, filepath.Join(patchDir, patchRecordFile), bs)
+}
+
+// updateIntegrityManifest replaces or appends entries into integrity manifest if the manifest exists.
+func updateIntegrityManifest(pkgFsys *WebFileSystem, entries []IntegrityFileEntry) error {
+	manifest, err := readIntegrityManifest(pkgFsys)
+	if errors.Is(err, ErrNoIntegrityManifest) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if i := slices.IndexFunc(manifest.Files, func(e IntegrityFileEntry) bool { return e.Path == entry.Path }); i >= 0 {
+			manifest.Files[i] = entry
+		} else {
+			manifest.Files = append(manifest.Files, entry)
+		}
+	}
+	slices.SortFunc(manifest.Files, func(a, b IntegrityFileEntry) int { return strings.Compare(a.Path, b.Path) })
+	return writeIntegrityManifest(pkgFsys, IntegrityManifestFile, manifest)
+}
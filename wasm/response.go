@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"syscall/js"
+	"time"
 )
 
 func SendBackStatusAppLaunchOK() {
@@ -25,6 +26,10 @@ func SendBackStatusEngineStartOK() {
 	postMessage("engineStatus", []any{"appEngineStartOK", true})
 }
 
+func SendBackStatusEngineQuit() {
+	postMessage("engineStatus", []any{"appEngineQuit", true})
+}
+
 func SendBackStatusAppShutdown() {
 	postMessage("engineStatus", []any{"appShutdown", true})
 }
@@ -41,6 +46,75 @@ func SendBackSavZipBytes(methodName string, bs js.Value) {
 	postMessage("methodResult", []any{methodName, bs})
 }
 
+func SendBackBackupZipBytes(methodName string, bs js.Value) {
+	postMessage("methodResult", []any{methodName, bs})
+}
+
+func SendBackCrashReportsZipBytes(methodName string, bs js.Value) {
+	postMessage("methodResult", []any{methodName, bs})
+}
+
+func SendBackRestoredPackages(methodName string, restored []RestoredPackage) {
+	results := make([]any, 0, len(restored))
+	for _, r := range restored {
+		results = append(results, r.ToJsValue())
+	}
+	postMessage("methodResult", []any{methodName, results})
+}
+
+func SendBackIntegrityReport(methodName string, report *IntegrityReport) {
+	postMessage("methodResult", []any{methodName, report.ToJsValue()})
+}
+
+func SendBackPackageReport(methodName string, report *PackageReport) {
+	postMessage("methodResult", []any{methodName, report.ToJsValue()})
+}
+
+func SendBackPatchRecord(methodName string, record *PatchRecord) {
+	postMessage("methodResult", []any{methodName, record.ToJsValue()})
+}
+
+func SendBackTranscriptBytes(methodName string, bs js.Value) {
+	postMessage("methodResult", []any{methodName, bs})
+}
+
+func SendBackSessionRecordBytes(methodName string, bs js.Value) {
+	postMessage("methodResult", []any{methodName, bs})
+}
+
+func SendBackCommandHistory(methodName string, commands []string) {
+	postMessage("methodResult", []any{methodName, stringsToAny(commands)})
+}
+
+// SendBackMacros sends macros as array of objects parsed from macrosJson.
+func SendBackMacros(methodName string, macrosJson string) {
+	postMessage("methodResult", []any{methodName, js.Global().Get("JSON").Call("parse", macrosJson)})
+}
+
+func SendBackSaveBytes(methodName string, bs js.Value) {
+	postMessage("methodResult", []any{methodName, bs})
+}
+
+func SendBackSaveSlots(methodName string, infos []SaveSlotInfo) {
+	results := make([]any, 0, len(infos))
+	for _, info := range infos {
+		results = append(results, info.ToJsValue())
+	}
+	postMessage("methodResult", []any{methodName, results})
+}
+
+func SendBackSaveBackups(methodName string, infos []SaveBackupInfo) {
+	results := make([]any, 0, len(infos))
+	for _, info := range infos {
+		results = append(results, info.ToJsValue())
+	}
+	postMessage("methodResult", []any{methodName, results})
+}
+
+func SendBackSaveImportResult(methodName string, result *SaveImportResult) {
+	postMessage("methodResult", []any{methodName, result.ToJsValue()})
+}
+
 func SendBackStringWidth(methodName string, width int32) {
 	postMessage("methodResult", []any{methodName, int(width)})
 }
@@ -63,6 +137,45 @@ func SendBackMethodNotImplemented(methodName string) {
 	SendBackMethodError(methodName, ErrNotImplemented)
 }
 
+func SendBackParagraphReplay(methodName string, replay *ParagraphReplay) {
+	postMessage("methodResult", []any{methodName, replay.ToJsValue()})
+}
+
+func SendBackEngineState(methodName string, state *engineState) {
+	postMessage("methodResult", []any{methodName, state.ToJsValue()})
+}
+
+func SendBackEngineCrash(report *CrashReport) {
+	postMessage("engineCrash", report.ToJsValue())
+}
+
+func SendBackSessionReplayResult(result *SessionReplayResult) {
+	postMessage("sessionReplayResult", result.ToJsValue())
+}
+
+// SendBackMacroStatus notifies running state of macro. reason is set when the macro stops.
+func SendBackMacroStatus(name string, running bool, iteration int, reason string) {
+	postMessage("macroStatus", map[string]any{
+		"name":      name,
+		"running":   running,
+		"iteration": iteration,
+		"reason":    reason,
+	})
+}
+
+func SendBackLogEvent(level string, timestamp time.Time, message string) {
+	postMessage("logEvent", map[string]any{
+		"level":     level,
+		"timestamp": timestamp.UnixMilli(),
+		"message":   message,
+	})
+}
+
 func postMessage(action string, value any) {
 	js.Global().Get("self").Call("postMessage", []any{action, value})
 }
+
+// postMessageTransfer is same as postMessage but transfers ownership of transfers, e.g. ArrayBuffer.
+func postMessageTransfer(action string, value any, transfers []any) {
+	js.Global().Get("self").Call("postMessage", []any{action, value}, transfers)
+}
@@ -0,0 +1,192 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+// saveBackupDir stores previous versions of save files, under the package root.
+// Each save file has own directory, e.g. [saveBackupDir]/save00.sav/[backupID].
+const saveBackupDir = ".erago-wasm-save-backups"
+
+// DefaultSaveBackupCount is the default number of backups kept for each save file.
+const DefaultSaveBackupCount = 5
+
+// currentSaveBackupCount is EngineOptions.SaveBackupCount of the last engine initialization.
+// It is used by restore_save_backup, which runs while the engine is not initialized.
+var currentSaveBackupCount = DefaultSaveBackupCount
+
+var ErrSaveBackupNotFound = errors.New("save backup not found")
+
+// SaveBackupFileSystem keeps previous versions of save files when the engine overwrites them through Store.
+type SaveBackupFileSystem struct {
+	*WebFileSystem
+	saveDir string
+	keep    int
+}
+
+// NewSaveBackupFileSystem wraps pkgFsys, the package root, to keep last keep versions of each save file.
+// keep <= 0 disables backup.
+func NewSaveBackupFileSystem(pkgFsys *WebFileSystem, keep int) (*SaveBackupFileSystem, error) {
+	_, saveDir, err := openSaveDir(pkgFsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	return &SaveBackupFileSystem{
+		WebFileSystem: pkgFsys,
+		saveDir:       saveDir,
+		keep:          keep,
+	}, nil
+}
+
+func (fsys *SaveBackupFileSystem) Store(fpath string) (model.WriteCloser, error) {
+	if fsys.keep > 0 {
+		if rel, err := fsys.relPath(fpath); err == nil && filepath.Dir(rel) == fsys.saveDir && isSaveFileName(filepath.Base(rel)) {
+			if err := backupSaveFile(fsys.WebFileSystem, rel, fsys.keep); err != nil {
+				// backup is best effort. writing save file is more important.
+				fmt.Printf("save backup failed for %s: %v\n", rel, err)
+			}
+		}
+	}
+	return fsys.WebFileSystem.Store(fpath)
+}
+
+func isSaveFileName(name string) bool {
+	return name == shareSaveFileName || saveFileNamePattern.MatchString(name)
+}
+
+// backupSaveFile copies current content of savePath into backup directory, then removes old backups
+// to keep only last keep versions. It does nothing when savePath does not exist.
+func backupSaveFile(pkgFsys *WebFileSystem, savePath string, keep int) error {
+	if !pkgFsys.Exist(savePath) {
+		return nil
+	}
+	content, err := readAllFile(pkgFsys, savePath)
+	if err != nil {
+		return err
+	}
+	backupDir := filepath.Join(saveBackupDir, filepath.Base(savePath))
+	backupID := newSaveBackupID(pkgFsys, backupDir, time.Now())
+	if err := writeAllFile(pkgFsys, filepath.Join(backupDir, backupID), content); err != nil {
+		return err
+	}
+
+	ids, err := listSaveBackupIDs(pkgFsys, backupDir)
+	if err != nil {
+		return err
+	}
+	for len(ids) > keep {
+		if err := pkgFsys.Remove(filepath.Join(backupDir, ids[0])); err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// newSaveBackupID returns backup ID which is not used in backupDir. The ID is created time in milliseconds,
+// with sequence suffix when other backup is created in same millisecond.
+// The suffix keeps IDs sorted by name in created order.
+func newSaveBackupID(pkgFsys *WebFileSystem, backupDir string, now time.Time) string {
+	base := fmt.Sprintf("%016d", now.UnixMilli())
+	backupID := base
+	for seq := 1; pkgFsys.Exist(filepath.Join(backupDir, backupID)); seq++ {
+		backupID = fmt.Sprintf("%s-%04d", base, seq)
+	}
+	return backupID
+}
+
+// listSaveBackupIDs returns backup IDs in backupDir from oldest to newest.
+func listSaveBackupIDs(pkgFsys *WebFileSystem, backupDir string) ([]string, error) {
+	if !pkgFsys.ExistDir(backupDir) {
+		return []string{}, nil
+	}
+	entries, err := pkgFsys.ReadDir(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir {
+			ids = append(ids, entry.Name) // already sorted by name, that is created time.
+		}
+	}
+	return ids, nil
+}
+
+// SaveBackupInfo is information of a backup of save file.
+type SaveBackupInfo struct {
+	SaveSlotInfo
+	BackupID string
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (info SaveBackupInfo) ToJsValue() map[string]any {
+	v := info.SaveSlotInfo.ToJsValue()
+	v["backupId"] = info.BackupID
+	return v
+}
+
+// ListSaveBackups lists backups of the save file for slot, from newest to oldest.
+func ListSaveBackups(fsys *WebFileSystem, rootPath string, slot int) ([]SaveBackupInfo, error) {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	savePath, err := saveSlotPath(saveDir, slot)
+	if err != nil {
+		return nil, err
+	}
+	backupDir := filepath.Join(saveBackupDir, filepath.Base(savePath))
+	ids, err := listSaveBackupIDs(pkgFsys, backupDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SaveBackupInfo, 0, len(ids))
+	for _, id := range slices.Backward(ids) {
+		info, err := statSaveSlot(pkgFsys, filepath.Join(backupDir, id))
+		if err != nil {
+			return nil, err
+		}
+		info.Slot = slot
+		info.FileName = filepath.Base(savePath)
+		infos = append(infos, SaveBackupInfo{SaveSlotInfo: info, BackupID: id})
+	}
+	return infos, nil
+}
+
+// RestoreSaveBackup overwrites the save file for slot by its backup of backupID.
+// Current save file is also backed up before restore within keep backups, so that the restore can be undone.
+// keep <= 0 disables backup as NewSaveBackupFileSystem does.
+func RestoreSaveBackup(fsys *WebFileSystem, rootPath string, slot int, backupID string, keep int) error {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return err
+	}
+	savePath, err := saveSlotPath(saveDir, slot)
+	if err != nil {
+		return err
+	}
+	backupPath := filepath.Join(saveBackupDir, filepath.Base(savePath), backupID)
+	if !filepath.IsLocal(backupID) || !pkgFsys.Exist(backupPath) {
+		return fmt.Errorf("%w: slot %d, id %s", ErrSaveBackupNotFound, slot, backupID)
+	}
+	content, err := readAllFile(pkgFsys, backupPath)
+	if err != nil {
+		return err
+	}
+	if keep > 0 {
+		if err := backupSaveFile(pkgFsys, savePath, keep); err != nil {
+			return err
+		}
+	}
+	return writeAllFile(pkgFsys, savePath, content)
+}
@@ -0,0 +1,169 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// SaveMergePolicy indicates how to resolve existing save file on importing saves.
+type SaveMergePolicy int
+
+const (
+	SaveMergeOverwrite SaveMergePolicy = iota
+	SaveMergeKeepExisting
+	SaveMergeKeepNewer
+)
+
+var ErrUnknownSaveMergePolicy = errors.New("unknown save merge policy")
+
+// ParseSaveMergePolicy parses policy name, one of "overwrite", "keep_existing" or "keep_newer".
+// Empty name is treated as "overwrite", same as model.ImportSav.
+func ParseSaveMergePolicy(name string) (SaveMergePolicy, error) {
+	switch name {
+	case "", "overwrite":
+		return SaveMergeOverwrite, nil
+	case "keep_existing":
+		return SaveMergeKeepExisting, nil
+	case "keep_newer":
+		return SaveMergeKeepNewer, nil
+	default:
+		return SaveMergeOverwrite, fmt.Errorf("%w: %s", ErrUnknownSaveMergePolicy, name)
+	}
+}
+
+// SaveImportResult is slots added, replaced or skipped by ImportSavesMerged.
+// NoTimestamp is slots which are skipped by SaveMergeKeepNewer since the zip entry has no modified time,
+// and is also contained in Skipped.
+type SaveImportResult struct {
+	DryRun      bool
+	Added       []int
+	Replaced    []int
+	Skipped     []int
+	NoTimestamp []int
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *SaveImportResult) ToJsValue() map[string]any {
+	return map[string]any{
+		"dryRun":      r.DryRun,
+		"added":       intsToAny(r.Added),
+		"replaced":    intsToAny(r.Replaced),
+		"skipped":     intsToAny(r.Skipped),
+		"noTimestamp": intsToAny(r.NoTimestamp),
+	}
+}
+
+// ImportSavesMerged imports save files in zipBytes, which is created by ExportSaves or model.ExportSav, into
+// the package at rootPath. Existing save files are resolved by policy.
+// When dryRun is true, nothing is written and the result tells what would be done.
+// All save files in the zip must be under the save directory of the package and have valid save header.
+func ImportSavesMerged(fsys *WebFileSystem, rootPath string, zipBytes []byte, policy SaveMergePolicy, dryRun bool, limits ArchiveLimits) (*SaveImportResult, error) {
+	if err := limits.CheckZip(zipBytes); err != nil {
+		return nil, err
+	}
+	zReader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+	if err != nil {
+		return nil, err
+	}
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	type saveEntry struct {
+		slot    int
+		path    string
+		content []byte
+	}
+	// validate all entries before writing anything.
+	entries := make([]saveEntry, 0, len(zReader.File))
+	result := &SaveImportResult{DryRun: dryRun, Added: []int{}, Replaced: []int{}, Skipped: []int{}, NoTimestamp: []int{}}
+	for _, zf := range zReader.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.FromSlash(path.Clean(zf.Name))
+		if !filepath.IsLocal(name) || filepath.Dir(name) != saveDir {
+			return nil, fmt.Errorf("%w: %s is not under save directory %s", ErrInvalidSaveData, zf.Name, saveDir)
+		}
+		slot, ok := slotOfSaveFileName(filepath.Base(name))
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not a save file", ErrInvalidSaveData, zf.Name)
+		}
+		content, err := readAllZipFile(zf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := readSaveHeader(bytes.NewReader(content)); err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+
+		if !pkgFsys.Exist(name) {
+			result.Added = append(result.Added, slot)
+			entries = append(entries, saveEntry{slot, name, content})
+			continue
+		}
+		modTime, hasModTime := zipModTime(zf)
+		if policy == SaveMergeKeepNewer && !hasModTime {
+			// can not tell which is newer, keep existing and report it.
+			result.Skipped = append(result.Skipped, slot)
+			result.NoTimestamp = append(result.NoTimestamp, slot)
+			continue
+		}
+		replace, err := shouldReplaceSave(pkgFsys, name, modTime, policy)
+		if err != nil {
+			return nil, err
+		}
+		if replace {
+			result.Replaced = append(result.Replaced, slot)
+			entries = append(entries, saveEntry{slot, name, content})
+		} else {
+			result.Skipped = append(result.Skipped, slot)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	for _, entry := range entries {
+		if err := writeAllFile(pkgFsys, entry.path, entry.content); err != nil {
+			return nil, fmt.Errorf("failed to import slot %d: %w", entry.slot, err)
+		}
+	}
+	return result, nil
+}
+
+func shouldReplaceSave(pkgFsys *WebFileSystem, existingPath string, incomingModTime time.Time, policy SaveMergePolicy) (bool, error) {
+	switch policy {
+	case SaveMergeOverwrite:
+		return true, nil
+	case SaveMergeKeepExisting:
+		return false, nil
+	case SaveMergeKeepNewer:
+		finfo, err := pkgFsys.Stat(existingPath)
+		if err != nil {
+			return false, err
+		}
+		// zip has older one, keep existing.
+		return incomingModTime.After(finfo.ModTime()), nil
+	default:
+		return false, fmt.Errorf("%w: %d", ErrUnknownSaveMergePolicy, policy)
+	}
+}
+
+// zipModTime returns modified time of zf. It returns false when zf has no modified time,
+// such as entries created by model.ExportSav, which are stored with zero MS-DOS date and time.
+func zipModTime(zf *zip.File) (time.Time, bool) {
+	if zf.ModifiedDate == 0 && zf.ModifiedTime == 0 {
+		return time.Time{}, false
+	}
+	return zf.Modified, true
+}
@@ -0,0 +1,312 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mzki/erago/app"
+)
+
+const (
+	// same as github.com/mzki/erago/state.DefaultMetaIdent
+	saveMetaIdent = "erago"
+	// same as github.com/mzki/erago/state.MetaTitleLimit
+	saveMetaTitleLimit = 120
+	// share data file which is not related to slot.
+	shareSaveFileName = "share.sav"
+	// ShareSaveSlot is a slot number to indicate share data file.
+	ShareSaveSlot = -1
+)
+
+var (
+	ErrSaveSlotNotFound = errors.New("save slot not found")
+	ErrInvalidSaveSlot  = errors.New("invalid save slot")
+	ErrInvalidSaveData  = errors.New("invalid save data")
+)
+
+var saveFileNamePattern = regexp.MustCompile(`^save(\d+)\.sav$`)
+
+// SaveFileName returns save file name for slot, same format as erago uses.
+func SaveFileName(slot int) string {
+	if slot == ShareSaveSlot {
+		return shareSaveFileName
+	}
+	return fmt.Sprintf("save%02d.sav", slot)
+}
+
+// slotOfSaveFileName returns slot number for save file name. It returns false if name is not a save file.
+func slotOfSaveFileName(name string) (int, bool) {
+	if name == shareSaveFileName {
+		return ShareSaveSlot, true
+	}
+	m := saveFileNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return 0, false
+	}
+	slot, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return slot, true
+}
+
+// SaveSlotInfo is information of a save file.
+type SaveSlotInfo struct {
+	Slot        int
+	FileName    string
+	Size        int64
+	ModTime     time.Time
+	GameVersion int32
+	Comment     string
+	HeaderOK    bool // false when header could not be parsed. GameVersion and Comment are empty in that case.
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (info SaveSlotInfo) ToJsValue() map[string]any {
+	return map[string]any{
+		"slot":        info.Slot,
+		"fileName":    info.FileName,
+		"size":        info.Size,
+		"modTime":     info.ModTime.UnixMilli(),
+		"gameVersion": int(info.GameVersion),
+		"comment":     info.Comment,
+		"headerOK":    info.HeaderOK,
+	}
+}
+
+type saveHeader struct {
+	GameVersion int32
+	Comment     string
+}
+
+// readSaveHeader reads metadata at the head of save file. The format is same as
+// github.com/mzki/erago/infra/repo, identifier(5bytes), version(int32), comment length(int32) and comment.
+func readSaveHeader(r io.Reader) (*saveHeader, error) {
+	ident := make([]byte, len(saveMetaIdent))
+	if _, err := io.ReadFull(r, ident); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSaveData, err)
+	}
+	if string(ident) != saveMetaIdent {
+		return nil, fmt.Errorf("%w: unknown identifier %q", ErrInvalidSaveData, ident)
+	}
+	var version, commentLen int32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSaveData, err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &commentLen); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSaveData, err)
+	}
+	if commentLen < 0 {
+		return nil, fmt.Errorf("%w: comment length %d out of range", ErrInvalidSaveData, commentLen)
+	}
+	// engine writes comment of any length but reads only first saveMetaTitleLimit bytes.
+	comment := make([]byte, min(commentLen, saveMetaTitleLimit))
+	if _, err := io.ReadFull(r, comment); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSaveData, err)
+	}
+	if rest := int64(commentLen) - int64(len(comment)); rest > 0 {
+		if _, err := io.CopyN(io.Discard, r, rest); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSaveData, err)
+		}
+	}
+	return &saveHeader{GameVersion: version, Comment: string(comment)}, nil
+}
+
+// openSaveDir returns filesystem of the package at rootPath and its save directory.
+func openSaveDir(fsys *WebFileSystem, rootPath string) (pkgFsys *WebFileSystem, saveDir string, err error) {
+	pkgFsys, err = fsys.subOrSelf(rootPath)
+	if err != nil {
+		return nil, "", err
+	}
+	appConf, err := LoadPackageConfig(pkgFsys)
+	if err != nil && !errors.Is(err, app.ErrDefaultConfigGenerated) {
+		return nil, "", err
+	}
+	return pkgFsys, filepath.Clean(appConf.Game.RepoConfig.SaveFileDir), nil
+}
+
+func saveSlotPath(saveDir string, slot int) (string, error) {
+	if slot < 0 && slot != ShareSaveSlot {
+		return "", fmt.Errorf("%w: %d", ErrInvalidSaveSlot, slot)
+	}
+	return filepath.Join(saveDir, SaveFileName(slot)), nil
+}
+
+// ListSaves lists save files in the package at rootPath ordered by file name.
+// Share data file is listed with ShareSaveSlot.
+func ListSaves(fsys *WebFileSystem, rootPath string) ([]SaveSlotInfo, error) {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if !pkgFsys.ExistDir(saveDir) {
+		return []SaveSlotInfo{}, nil
+	}
+	entries, err := pkgFsys.ReadDir(saveDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]SaveSlotInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		slot, ok := slotOfSaveFileName(entry.Name)
+		if !ok {
+			continue // not a save file.
+		}
+		info, err := statSaveSlot(pkgFsys, filepath.Join(saveDir, entry.Name))
+		if err != nil {
+			return nil, err
+		}
+		info.Slot = slot
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func statSaveSlot(pkgFsys *WebFileSystem, path string) (SaveSlotInfo, error) {
+	finfo, err := pkgFsys.Stat(path)
+	if err != nil {
+		return SaveSlotInfo{}, err
+	}
+	info := SaveSlotInfo{
+		FileName: filepath.Base(path),
+		Size:     finfo.Size(),
+		ModTime:  finfo.ModTime(),
+	}
+	r, err := pkgFsys.Load(path)
+	if err != nil {
+		return SaveSlotInfo{}, err
+	}
+	defer r.Close()
+	if header, err := readSaveHeader(r); err == nil {
+		info.GameVersion = header.GameVersion
+		info.Comment = header.Comment
+		info.HeaderOK = true
+	}
+	return info, nil
+}
+
+// ExportSaveSlot returns content of the save file for slot.
+func ExportSaveSlot(fsys *WebFileSystem, rootPath string, slot int) ([]byte, error) {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	path, err := saveSlotPath(saveDir, slot)
+	if err != nil {
+		return nil, err
+	}
+	if !pkgFsys.Exist(path) {
+		return nil, fmt.Errorf("%w: %d", ErrSaveSlotNotFound, slot)
+	}
+	return readAllFile(pkgFsys, path)
+}
+
+// ExportSaves returns zip archive of all files in the save directory of the package at rootPath,
+// same layout as model.ExportSav. Unlike model.ExportSav, each entry has modified time of the file
+// so that ImportSavesMerged can resolve by SaveMergeKeepNewer.
+// It returns empty bytes when no save files are found.
+func ExportSaves(fsys *WebFileSystem, rootPath string) ([]byte, error) {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return nil, err
+	}
+	if !pkgFsys.ExistDir(saveDir) {
+		return []byte{}, nil
+	}
+	entries, err := pkgFsys.ReadDir(saveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	found := false
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		path := filepath.Join(saveDir, entry.Name)
+		finfo, err := pkgFsys.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		content, err := readAllFile(pkgFsys, path)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zWriter.CreateHeader(&zip.FileHeader{
+			Name:     filepath.ToSlash(path),
+			Method:   zip.Deflate,
+			Modified: finfo.ModTime(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if !found {
+		return []byte{}, nil
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ImportSaveSlot writes content as the save file for slot. The content must have valid save header.
+func ImportSaveSlot(fsys *WebFileSystem, rootPath string, slot int, content []byte) error {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return err
+	}
+	path, err := saveSlotPath(saveDir, slot)
+	if err != nil {
+		return err
+	}
+	if _, err := readSaveHeader(bytes.NewReader(content)); err != nil {
+		return err
+	}
+	return writeAllFile(pkgFsys, path, content)
+}
+
+// DeleteSaveSlot removes the save file for slot.
+func DeleteSaveSlot(fsys *WebFileSystem, rootPath string, slot int) error {
+	pkgFsys, saveDir, err := openSaveDir(fsys, rootPath)
+	if err != nil {
+		return err
+	}
+	path, err := saveSlotPath(saveDir, slot)
+	if err != nil {
+		return err
+	}
+	if !pkgFsys.Exist(path) {
+		return fmt.Errorf("%w: %d", ErrSaveSlotNotFound, slot)
+	}
+	return pkgFsys.Remove(path)
+}
+
+// CopySaveSlot copies the save file for slot from into slot to. Existing save file at slot to is overwritten.
+func CopySaveSlot(fsys *WebFileSystem, rootPath string, from, to int) error {
+	content, err := ExportSaveSlot(fsys, rootPath, from)
+	if err != nil {
+		return err
+	}
+	return ImportSaveSlot(fsys, rootPath, to, content)
+}
@@ -0,0 +1,151 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// DefaultScrollbackSize is the default number of fixed paragraphs kept for replay.
+const DefaultScrollbackSize = 2000
+
+// ParagraphEntry is a paragraph published by the engine with its sequence number.
+// Bytes is encoded by EngineOptions.MessageByteEncoding.
+type ParagraphEntry struct {
+	Seq       uint64
+	Bytes     []byte
+	Temporary bool
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (p ParagraphEntry) ToJsValue() map[string]any {
+	return map[string]any{
+		"seq":       p.Seq,
+		"bytes":     ToJsBytes(p.Bytes),
+		"temporary": p.Temporary,
+	}
+}
+
+// scrollback keeps paragraphs currently shown on the screen, up to capacity, so that UI can
+// reconstruct the screen by replay. It follows the semantics of erago's publisher callback:
+// temporary paragraph is replaced by next publish, and remove also discards the temporary one.
+//
+// Every operation consumes one sequence number, so that sequence numbers are monotonically
+// increasing through all of the engine events.
+type scrollback struct {
+	mu        sync.Mutex
+	capacity  int
+	fixed     []ParagraphEntry
+	temporary *ParagraphEntry
+	lastSeq   uint64 // 0 means nothing is published yet.
+	droppedTo uint64 // the newest sequence number dropped due to capacity.
+}
+
+func newScrollback(capacity int) *scrollback {
+	if capacity <= 0 {
+		capacity = DefaultScrollbackSize
+	}
+	return &scrollback{capacity: capacity}
+}
+
+func (sb *scrollback) nextSeq() uint64 {
+	sb.lastSeq += 1
+	return sb.lastSeq
+}
+
+// Advance consumes sequence number for an event which does not change paragraphs, such as input request.
+func (sb *scrollback) Advance() uint64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.nextSeq()
+}
+
+// Publish appends fixed paragraph and returns its sequence number.
+func (sb *scrollback) Publish(bs []byte) uint64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	seq := sb.nextSeq()
+	sb.temporary = nil
+	sb.fixed = append(sb.fixed, ParagraphEntry{Seq: seq, Bytes: bytes.Clone(bs)})
+	if over := len(sb.fixed) - sb.capacity; over > 0 {
+		// drop oldest ones. dropped memory is released when append reallocates.
+		sb.droppedTo = sb.fixed[over-1].Seq
+		sb.fixed = sb.fixed[over:]
+	}
+	return seq
+}
+
+// PublishTemporary replaces temporary paragraph and returns its sequence number.
+func (sb *scrollback) PublishTemporary(bs []byte) uint64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	seq := sb.nextSeq()
+	sb.temporary = &ParagraphEntry{Seq: seq, Bytes: bytes.Clone(bs), Temporary: true}
+	return seq
+}
+
+// Remove removes last nParagraph fixed paragraphs and temporary paragraph.
+// It returns sequence number of this operation.
+func (sb *scrollback) Remove(nParagraph int) uint64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	seq := sb.nextSeq()
+	sb.temporary = nil
+	n := min(max(nParagraph, 0), len(sb.fixed))
+	sb.fixed = sb.fixed[:len(sb.fixed)-n]
+	return seq
+}
+
+// RemoveAll removes all paragraphs. It returns sequence number of this operation.
+func (sb *scrollback) RemoveAll() uint64 {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	seq := sb.nextSeq()
+	sb.temporary = nil
+	sb.fixed = nil
+	sb.droppedTo = 0 // dropped ones are no longer on the screen.
+	return seq
+}
+
+// ParagraphReplay is result of scrollback.Replay.
+type ParagraphReplay struct {
+	Paragraphs []ParagraphEntry // ordered by Seq. temporary paragraph is the last one if exists.
+	LastSeq    uint64           // sequence number of the last operation.
+	Truncated  bool             // some paragraphs after fromSeq are no longer kept due to capacity.
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *ParagraphReplay) ToJsValue() map[string]any {
+	paragraphs := make([]any, 0, len(r.Paragraphs))
+	for _, p := range r.Paragraphs {
+		paragraphs = append(paragraphs, p.ToJsValue())
+	}
+	return map[string]any{
+		"paragraphs": paragraphs,
+		"lastSeq":    r.LastSeq,
+		"truncated":  r.Truncated,
+	}
+}
+
+// Replay returns paragraphs currently on the screen whose sequence number is fromSeq or later.
+// fromSeq = 0 returns all of kept paragraphs to reconstruct the screen.
+func (sb *scrollback) Replay(fromSeq uint64) *ParagraphReplay {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	replay := &ParagraphReplay{
+		Paragraphs: make([]ParagraphEntry, 0, len(sb.fixed)+1),
+		LastSeq:    sb.lastSeq,
+	}
+	replay.Truncated = sb.droppedTo != 0 && sb.droppedTo >= fromSeq
+	for _, p := range sb.fixed {
+		if p.Seq >= fromSeq {
+			replay.Paragraphs = append(replay.Paragraphs, p)
+		}
+	}
+	if sb.temporary != nil && sb.temporary.Seq >= fromSeq {
+		replay.Paragraphs = append(replay.Paragraphs, *sb.temporary)
+	}
+	return replay
+}
@@ -0,0 +1,364 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mzki/erago-wasm/paratext"
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+const (
+	// sessionRecordDir stores session records under the package root.
+	sessionRecordDir = ".erago-wasm-sessions"
+	// maxSessionRecords is the number of session records kept in sessionRecordDir.
+	maxSessionRecords = 5
+
+	sessionRecordVersion = 1
+)
+
+// SessionRecord is a recorded session: inputs sent to the engine and texts of fixed paragraphs
+// published by the engine.
+//
+// Replay is deterministic only as far as the game depends on inputs and the random seed.
+// A game which calls math.randomseed by itself or uses current time diverges on replay.
+type SessionRecord struct {
+	Version    int            `json:"version"`
+	AppVersion string         `json:"appVersion"`
+	RootPath   string         `json:"rootPath"`
+	Seed       int64          `json:"seed"`
+	StartedAt  time.Time      `json:"startedAt"`
+	Inputs     []SessionInput `json:"inputs"`
+	Outputs    []string       `json:"outputs"` // texts of fixed paragraphs in published order.
+}
+
+// SessionInput is an input method called by UI.
+type SessionInput struct {
+	ElapsedMs   int64     `json:"elapsedMs"`   // from the start of the session.
+	OutputIndex int       `json:"outputIndex"` // number of outputs published before this input.
+	Method      string    `json:"method"`
+	Command     string    `json:"command,omitempty"` // for send_command.
+	Values      []float64 `json:"values,omitempty"`  // for set_viewsize and set_textunit_px.
+}
+
+// sessionSeedRandom seeds global source of math/rand, which math.random of game script uses
+// through gopher-lua. rand.Seed is effective as long as go.mod declares go 1.23 or older,
+// otherwise GODEBUG randseednop=0 is required.
+func sessionSeedRandom(seed int64) {
+	rand.Seed(seed)
+}
+
+// sessionRecorder records inputs and outputs of an engine lifetime.
+type sessionRecorder struct {
+	fsys     *WebFileSystem // package root.
+	encoding int
+	start    time.Time
+
+	mu     sync.Mutex
+	record SessionRecord
+}
+
+// newSessionRecorder creates recorder and seeds random source so that the session can be replayed.
+// It should be called before engine initialization.
+func newSessionRecorder(fsys *WebFileSystem, rootPath string, encoding int) *sessionRecorder {
+	start := time.Now()
+	seed := start.UnixNano()
+	sessionSeedRandom(seed)
+	return &sessionRecorder{
+		fsys:     fsys,
+		encoding: encoding,
+		start:    start,
+		record: SessionRecord{
+			Version:    sessionRecordVersion,
+			AppVersion: VERSION,
+			RootPath:   rootPath,
+			Seed:       seed,
+			StartedAt:  start,
+		},
+	}
+}
+
+// RecordInput records input method. values are arguments of set_viewsize and set_textunit_px.
+func (r *sessionRecorder) RecordInput(method string, command string, values ...float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.Inputs = append(r.record.Inputs, SessionInput{
+		ElapsedMs:   time.Since(r.start).Milliseconds(),
+		OutputIndex: len(r.record.Outputs),
+		Method:      method,
+		Command:     command,
+		Values:      values,
+	})
+}
+
+// RecordOutput records fixed paragraph.
+func (r *sessionRecorder) RecordOutput(bs []byte) {
+	text, err := paratext.Decode(bs, r.encoding)
+	if err != nil {
+		fmt.Printf("session recorder: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record.Outputs = append(r.record.Outputs, text)
+}
+
+// Marshal returns JSON of the session recorded so far.
+func (r *sessionRecorder) Marshal() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(&r.record)
+}
+
+// Persist writes the record into sessionRecordDir and removes older ones over maxSessionRecords.
+func (r *sessionRecorder) Persist() error {
+	content, err := r.Marshal()
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("session-%016d.json", r.start.UnixMilli())
+	if err := writeAllFile(r.fsys, filepath.Join(sessionRecordDir, name), content); err != nil {
+		return err
+	}
+	entries, err := r.fsys.ReadDir(sessionRecordDir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir {
+			names = append(names, entry.Name)
+		}
+	}
+	slices.Sort(names) // older first since names contain zero-padded time.
+	for len(names) > maxSessionRecords {
+		if err := r.fsys.Remove(filepath.Join(sessionRecordDir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// ExportSessionRecords archives session records of the package at rootPath into zip bytes.
+func ExportSessionRecords(fsys *WebFileSystem, rootPath string) ([]byte, error) {
+	pkgFsys, err := fsys.subOrSelf(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	zWriter := zip.NewWriter(buf)
+	if pkgFsys.ExistDir(sessionRecordDir) {
+		entries, err := pkgFsys.ReadDir(sessionRecordDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir {
+				continue
+			}
+			content, err := readAllFile(pkgFsys, filepath.Join(sessionRecordDir, entry.Name))
+			if err != nil {
+				return nil, err
+			}
+			w, err := zWriter.Create(entry.Name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := zWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseSessionRecord parses JSON of SessionRecord.
+func ParseSessionRecord(bs []byte) (*SessionRecord, error) {
+	record := &SessionRecord{}
+	if err := json.Unmarshal(bs, record); err != nil {
+		return nil, fmt.Errorf("invalid session record: %w", err)
+	}
+	if record.Version != sessionRecordVersion {
+		return nil, fmt.Errorf("unsupported session record version: %d", record.Version)
+	}
+	return record, nil
+}
+
+// SessionReplayResult is result of replay_session, sent as sessionReplayResult message.
+type SessionReplayResult struct {
+	Completed      bool   // all of inputs are replayed and outputs match.
+	Diverged       bool   // output differs from the record.
+	InputsReplayed int    // number of inputs sent to the engine.
+	InputsTotal    int    // number of inputs in the record.
+	OutputIndex    int    // index of the first diverged output.
+	Expected       string // recorded output at OutputIndex. empty when the engine published extra output.
+	Actual         string // replayed output at OutputIndex. empty when the engine did not publish it.
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *SessionReplayResult) ToJsValue() map[string]any {
+	return map[string]any{
+		"completed":      r.Completed,
+		"diverged":       r.Diverged,
+		"inputsReplayed": r.InputsReplayed,
+		"inputsTotal":    r.InputsTotal,
+		"outputIndex":    r.OutputIndex,
+		"expected":       r.Expected,
+		"actual":         r.Actual,
+	}
+}
+
+// sessionReplayer feeds recorded inputs to the engine and compares outputs with the record.
+// Inputs are fed in recorded order when the engine requests input, rather than recorded
+// timestamps, so that replay does not depend on speed of the engine.
+// Replay stops at the first divergence and the engine is left for inspection.
+type sessionReplayer struct {
+	record   *SessionRecord
+	encoding int
+
+	mu        sync.Mutex
+	nextInput int
+	nOutput   int
+	finished  bool
+}
+
+// newSessionReplayer creates replayer and seeds random source by the recorded seed.
+// It should be called before engine initialization.
+func newSessionReplayer(record *SessionRecord, encoding int) *sessionReplayer {
+	sessionSeedRandom(record.Seed)
+	return &sessionReplayer{record: record, encoding: encoding}
+}
+
+// CheckOutput compares fixed paragraph with the record.
+func (r *sessionReplayer) CheckOutput(bs []byte) {
+	text, err := paratext.Decode(bs, r.encoding)
+	if err != nil {
+		fmt.Printf("session replayer: %v\n", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	idx := r.nOutput
+	r.nOutput += 1
+	switch {
+	case idx >= len(r.record.Outputs):
+		r.finishLocked(true, idx, "", text)
+	case r.record.Outputs[idx] != text:
+		r.finishLocked(true, idx, r.record.Outputs[idx], text)
+	}
+}
+
+// OnInputRequested feeds inputs up to the next send_command.
+func (r *sessionReplayer) OnInputRequested() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	if r.nextInput >= len(r.record.Inputs) {
+		r.finishAtEndLocked()
+		return
+	}
+	var inputs []SessionInput
+	for r.nextInput < len(r.record.Inputs) {
+		input := r.record.Inputs[r.nextInput]
+		if input.Method == "send_command" && r.nOutput < input.OutputIndex {
+			// engine requests input before publishing recorded outputs.
+			r.finishLocked(true, r.nOutput, r.record.Outputs[r.nOutput], "")
+			return
+		}
+		inputs = append(inputs, input)
+		r.nextInput += 1
+		if input.Method == "send_command" {
+			break
+		}
+	}
+	// feed in another goroutine since this is called from the engine.
+	GoRecover("replay_session", func() {
+		for _, input := range inputs {
+			if err := replaySessionInput(input); err != nil {
+				fmt.Printf("session replayer: %s: %v\n", input.Method, err)
+			}
+		}
+	})
+}
+
+// Finish reports result when the engine quits before replay finishes.
+func (r *sessionReplayer) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.finished {
+		r.finishAtEndLocked()
+	}
+}
+
+func (r *sessionReplayer) finishAtEndLocked() {
+	if r.nOutput < len(r.record.Outputs) {
+		r.finishLocked(true, r.nOutput, r.record.Outputs[r.nOutput], "")
+		return
+	}
+	r.finishLocked(false, r.nOutput, "", "")
+}
+
+func (r *sessionReplayer) finishLocked(diverged bool, outputIndex int, expected, actual string) {
+	r.finished = true
+	SendBackSessionReplayResult(&SessionReplayResult{
+		Completed:      !diverged && r.nextInput >= len(r.record.Inputs),
+		Diverged:       diverged,
+		InputsReplayed: r.nextInput,
+		InputsTotal:    len(r.record.Inputs),
+		OutputIndex:    outputIndex,
+		Expected:       expected,
+		Actual:         actual,
+	})
+}
+
+func replaySessionInput(input SessionInput) error {
+	switch input.Method {
+	case "send_command":
+		model.SendCommand(input.Command)
+	case "send_ctrl_skipping_wait":
+		model.SendSkippingWait()
+		theEngineState.SetSkippingWait(true)
+	case "send_ctrl_stop_skipping_wait":
+		model.SendStopSkippingWait()
+		theEngineState.SetSkippingWait(false)
+	case "set_viewsize":
+		if len(input.Values) != 2 {
+			return fmt.Errorf("invalid values: %v", input.Values)
+		}
+		lineCount, lineWidth := int(input.Values[0]), int(input.Values[1])
+		if err := model.SetViewSize(lineCount, lineWidth); err != nil {
+			return err
+		}
+		theEngineState.SetViewSize(lineCount, lineWidth)
+	case "set_textunit_px":
+		if len(input.Values) != 2 {
+			return fmt.Errorf("invalid values: %v", input.Values)
+		}
+		if err := model.SetTextUnitPx(input.Values[0], input.Values[1]); err != nil {
+			return err
+		}
+		theEngineState.SetTextUnitPx(input.Values[0], input.Values[1])
+	default:
+		return fmt.Errorf("unknown method")
+	}
+	return nil
+}
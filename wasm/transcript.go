@@ -0,0 +1,171 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mzki/erago-wasm/paratext"
+	model "github.com/mzki/erago/mobile/model/v2"
+)
+
+const (
+	// transcriptFile stores plain text of fixed paragraphs under the package root.
+	transcriptFile = ".erago-wasm-transcript.txt"
+	// transcriptMaxSize is the size of transcript file at which next session starts a new file.
+	transcriptMaxSize = 4 * 1024 * 1024 // 4MByte
+)
+
+// TranscriptFormat is output format of ExportTranscript.
+type TranscriptFormat string
+
+const (
+	TranscriptFormatText TranscriptFormat = "text"
+	TranscriptFormatHTML TranscriptFormat = "html"
+)
+
+func ParseTranscriptFormat(s string) (TranscriptFormat, error) {
+	switch s {
+	case "", string(TranscriptFormatText):
+		return TranscriptFormatText, nil
+	case string(TranscriptFormatHTML):
+		return TranscriptFormatHTML, nil
+	default:
+		return "", fmt.Errorf("unknown transcript format: %s", s)
+	}
+}
+
+// transcriptWriter appends text of fixed paragraphs into transcript file during an engine lifetime.
+// Temporary paragraphs are not recorded, and removed paragraphs are kept since the transcript is
+// a record of what the engine printed rather than the current screen.
+type transcriptWriter struct {
+	fsys     *WebFileSystem // package root.
+	encoding int
+
+	mu sync.Mutex
+	w  model.WriteCloser // nil after Close or when opening failed.
+}
+
+// newTranscriptWriter opens transcript file in fsys and writes session header.
+// Failure of opening only disables the transcript, not the engine.
+// When enabled is false, nothing is recorded but existing transcript file can still be exported.
+func newTranscriptWriter(fsys *WebFileSystem, encoding int, enabled bool) *transcriptWriter {
+	t := &transcriptWriter{fsys: fsys, encoding: encoding}
+	if !enabled {
+		return t
+	}
+	if fi, err := fsys.Stat(transcriptFile); err == nil && fi.Size() > transcriptMaxSize {
+		if err := fsys.Remove(transcriptFile); err != nil {
+			fmt.Printf("transcript: failed to remove old transcript: %v\n", err)
+		}
+	}
+	w, err := fsys.Append(transcriptFile)
+	if err != nil {
+		fmt.Printf("transcript: disabled: %v\n", err)
+		return t
+	}
+	t.w = w
+	t.writeText(fmt.Sprintf("===== session started at %s =====", time.Now().Format(time.RFC3339)))
+	return t
+}
+
+// WriteParagraph appends text of paragraph bytes.
+func (t *transcriptWriter) WriteParagraph(bs []byte) {
+	if !t.recording() {
+		return // skip decoding.
+	}
+	text, err := paratext.Decode(bs, t.encoding)
+	if err != nil {
+		fmt.Printf("transcript: %v\n", err)
+		return
+	}
+	t.writeText(text)
+}
+
+func (t *transcriptWriter) recording() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.w != nil
+}
+
+func (t *transcriptWriter) writeText(text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return
+	}
+	if _, err := io.WriteString(t.w, text+"\n"); err != nil {
+		fmt.Printf("transcript: write error: %v\n", err)
+	}
+}
+
+// Export returns content of the transcript file in format. The file is reopened
+// around reading since OPFS does not allow reading a file opened for writing.
+func (t *transcriptWriter) Export(format TranscriptFormat) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w != nil {
+		if err := t.w.Close(); err != nil {
+			t.w = nil
+			return nil, err
+		}
+		defer func() {
+			w, err := t.fsys.Append(transcriptFile)
+			if err != nil {
+				fmt.Printf("transcript: disabled: %v\n", err)
+			}
+			t.w = w
+		}()
+	}
+	return exportTranscript(t.fsys, format)
+}
+
+func (t *transcriptWriter) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return nil
+	}
+	err := t.w.Close()
+	t.w = nil
+	return err
+}
+
+// ExportTranscript returns content of the transcript file of the package at rootPath in format.
+func ExportTranscript(fsys *WebFileSystem, rootPath string, format TranscriptFormat) ([]byte, error) {
+	pkgFsys, err := fsys.subOrSelf(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	return exportTranscript(pkgFsys, format)
+}
+
+func exportTranscript(pkgFsys *WebFileSystem, format TranscriptFormat) ([]byte, error) {
+	var text []byte
+	if pkgFsys.Exist(transcriptFile) {
+		var err error
+		if text, err = readAllFile(pkgFsys, transcriptFile); err != nil {
+			return nil, err
+		}
+	}
+	switch format {
+	case TranscriptFormatHTML:
+		return transcriptToHTML(text), nil
+	default:
+		return text, nil
+	}
+}
+
+func transcriptToHTML(text []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Transcript</title>\n</head>\n<body>\n<pre>\n")
+	buf.WriteString(html.EscapeString(string(text)))
+	buf.WriteString("</pre>\n</body>\n</html>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,181 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mzki/erago/app"
+)
+
+const (
+	upgradeStagingDir = ".upgrade-staging"
+	upgradeBackupDir  = ".upgrade-backup"
+)
+
+var ErrUpgradeValidationFailed = errors.New("validation failed for new package")
+
+// UpgradePackage replaces the package at rootPath by the new archive while preserving
+// runtime data of the old installation, such as save files, save backups, logs, session records and patch history.
+// The new archive is installed into a staging directory and validated before replacing the old one.
+// The old package is replaced as a whole after the new one is ready, and is restored from backup
+// when replacing failed.
+// The new archive is extracted within limits.
+// It returns the root path of the upgraded package, which is same as rootPath.
+func UpgradePackage(fsys *WebFileSystem, rootPath string, archiveBytes []byte, limits ArchiveLimits) (string, error) {
+	oldDir, err := backupRelPath(fsys, rootPath)
+	if err != nil {
+		return "", err
+	}
+	if !fsys.ExistDir(oldDir) {
+		return "", fmt.Errorf("package directory not found: %s", rootPath)
+	}
+	parentDir := filepath.Dir(oldDir)
+	stagingDir := filepath.Join(parentDir, upgradeStagingDir)
+	backupDir := filepath.Join(parentDir, upgradeBackupDir)
+	// remove leftovers from crashed upgrade.
+	for _, dir := range []string{stagingDir, backupDir} {
+		if fsys.ExistDir(dir) {
+			if err := fsys.Remove(dir); err != nil {
+				return "", err
+			}
+		}
+	}
+	defer fsys.Remove(stagingDir)
+
+	// install and validate new package.
+	stagingFsys, err := fsys.Sub(stagingDir, true)
+	if err != nil {
+		return "", err
+	}
+	extractedDir, err := InstallPackageWithIntegrity(stagingFsys, archiveBytes, limits)
+	if err != nil {
+		return "", fmt.Errorf("failed to install new package: %w", err)
+	}
+	newDir := filepath.Join(stagingDir, extractedDir)
+	if report, err := ValidatePackageDeep(fsys, newDir); err != nil {
+		return "", err
+	} else if !report.OK() {
+		return "", fmt.Errorf("%w: %v", ErrUpgradeValidationFailed, report.Errors)
+	}
+
+	// migrate runtime data.
+	if err := migratePackageData(fsys, oldDir, newDir); err != nil {
+		return "", fmt.Errorf("failed to migrate runtime data: %w", err)
+	}
+
+	// swap old and new.
+	if err := replaceDir(fsys, newDir, oldDir, backupDir); err != nil {
+		return "", fmt.Errorf("failed to replace old package: %w", err)
+	}
+	return rootPath, nil
+}
+
+// migratePackageData copies runtime data, such as save files, backups, logs, session records and patch history,
+// from oldDir into newDir. Save directory may be differ between old and new config.
+// It fails when any file in old runtime data is missing in newDir after copying.
+func migratePackageData(fsys *WebFileSystem, oldDir, newDir string) error {
+	oldFsys, err := fsys.Sub(oldDir, false)
+	if err != nil {
+		return err
+	}
+	newFsys, err := fsys.Sub(newDir, false)
+	if err != nil {
+		return err
+	}
+	oldConf, err := LoadPackageConfig(oldFsys)
+	if err != nil && !errors.Is(err, app.ErrDefaultConfigGenerated) {
+		return err
+	}
+	newConf, err := LoadPackageConfig(newFsys)
+	if err != nil {
+		return err
+	}
+
+	// packageRuntimeDirs returns same kinds of directories in same order for any config.
+	oldDirs := append(packageRuntimeDirs(oldConf), patchRootDir)
+	newDirs := append(packageRuntimeDirs(newConf), patchRootDir)
+	for i, oldRuntimeDir := range oldDirs {
+		if !oldFsys.ExistDir(oldRuntimeDir) {
+			continue
+		}
+		src, dst := filepath.Join(oldDir, oldRuntimeDir), filepath.Join(newDir, newDirs[i])
+		if err := copyFiles(fsys, src, dst); err != nil {
+			return err
+		}
+		if err := verifyCopiedFiles(fsys, src, dst); err != nil {
+			return err
+		}
+	}
+	for _, file := range packageRuntimeFiles() {
+		if !oldFsys.Exist(file) {
+			continue
+		}
+		content, err := readAllFile(oldFsys, file)
+		if err != nil {
+			return err
+		}
+		if err := writeAllFile(newFsys, file, content); err != nil {
+			return err
+		}
+		if !newFsys.Exist(file) {
+			return fmt.Errorf("runtime file %s is not migrated", file)
+		}
+	}
+	return nil
+}
+
+// verifyCopiedFiles checks all files under srcDir exist in dstDir with same size. Both are relative to fsys.
+func verifyCopiedFiles(fsys *WebFileSystem, srcDir, dstDir string) error {
+	files, err := fsys.WalkFiles(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(srcDir, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("unexpected file %s outside of %s", file, srcDir)
+		}
+		srcContent, err := readAllFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		dstContent, err := readAllFile(fsys, filepath.Join(dstDir, rel))
+		if err != nil {
+			return fmt.Errorf("runtime file %s is not migrated: %w", file, err)
+		}
+		if len(srcContent) != len(dstContent) {
+			return fmt.Errorf("runtime file %s is not migrated: size mismatch", file)
+		}
+	}
+	return nil
+}
+
+// copyFiles copies all files under srcDir into dstDir recursively. Both are relative to fsys.
+func copyFiles(fsys *WebFileSystem, srcDir, dstDir string) error {
+	files, err := fsys.WalkFiles(srcDir)
+	if err != nil {
+		return err
+	}
+	if _, err := fsys.Sub(dstDir, true); err != nil {
+		return err
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(srcDir, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("unexpected file %s outside of %s", file, srcDir)
+		}
+		content, err := readAllFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		if err := writeAllFile(fsys, filepath.Join(dstDir, rel), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
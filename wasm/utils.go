@@ -19,6 +19,30 @@ func ToJsBytes(bs []byte) js.Value {
 	return jsBs
 }
 
+func ToGoStrings(jsArray js.Value) []string {
+	ss := make([]string, jsArray.Length())
+	for i := range ss {
+		ss[i] = jsArray.Index(i).String()
+	}
+	return ss
+}
+
+func stringsToAny(ss []string) []any {
+	anys := make([]any, len(ss))
+	for i, s := range ss {
+		anys[i] = s
+	}
+	return anys
+}
+
+func intsToAny(is []int) []any {
+	anys := make([]any, len(is))
+	for i, v := range is {
+		anys[i] = v
+	}
+	return anys
+}
+
 func JsOptions(opt map[string]any) js.Value {
 	jsOpt := js.Global().Get("Object").New()
 	for k, v := range opt {
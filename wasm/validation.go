@@ -0,0 +1,154 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mzki/erago/app"
+)
+
+const (
+	scriptFileExt = ".lua"
+	csvFileExt    = ".csv"
+)
+
+// PackageDiagnostic is a finding of deep validation. Path is relative to the package root and
+// can be empty when the finding is not related to specific file.
+type PackageDiagnostic struct {
+	Path    string
+	Message string
+}
+
+func (d PackageDiagnostic) toJsValue() map[string]any {
+	return map[string]any{"path": d.Path, "message": d.Message}
+}
+
+// PackageReport is a result of ValidatePackageDeep.
+type PackageReport struct {
+	Errors      []PackageDiagnostic
+	Warnings    []PackageDiagnostic
+	ScriptCount int
+	CSVCount    int
+}
+
+// OK returns true when no errors are found. Warnings do not affect the result.
+func (r *PackageReport) OK() bool { return len(r.Errors) == 0 }
+
+func (r *PackageReport) addError(path, format string, args ...any) {
+	r.Errors = append(r.Errors, PackageDiagnostic{Path: filepath.ToSlash(path), Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *PackageReport) addWarning(path, format string, args ...any) {
+	r.Warnings = append(r.Warnings, PackageDiagnostic{Path: filepath.ToSlash(path), Message: fmt.Sprintf(format, args...)})
+}
+
+// ToJsValue converts to value which can be passed to js.ValueOf.
+func (r *PackageReport) ToJsValue() map[string]any {
+	errs := make([]any, 0, len(r.Errors))
+	for _, d := range r.Errors {
+		errs = append(errs, d.toJsValue())
+	}
+	warns := make([]any, 0, len(r.Warnings))
+	for _, d := range r.Warnings {
+		warns = append(warns, d.toJsValue())
+	}
+	return map[string]any{
+		"ok":          r.OK(),
+		"errors":      errs,
+		"warnings":    warns,
+		"scriptCount": r.ScriptCount,
+		"csvCount":    r.CSVCount,
+	}
+}
+
+// ValidatePackageDeep checks whether the package at rootPath can be loaded by the engine.
+// It parses erago config, verifies directories referenced by the config, and inspects script and CSV files.
+// Returned error is not nil only when validation itself can not be performed.
+func ValidatePackageDeep(fsys *WebFileSystem, rootPath string) (*PackageReport, error) {
+	report := &PackageReport{
+		Errors:   []PackageDiagnostic{},
+		Warnings: []PackageDiagnostic{},
+	}
+	if !fsys.ExistDir(rootPath) {
+		report.addError("", "package directory %s not found", rootPath)
+		return report, nil
+	}
+	pkgFsys, err := fsys.Sub(rootPath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	appConf, err := LoadPackageConfig(pkgFsys)
+	switch err {
+	case nil:
+	case app.ErrDefaultConfigGenerated:
+		report.addError(app.ConfigFile, "config file not found")
+		return report, nil
+	default:
+		report.addError(app.ConfigFile, "config file can not be parsed: %v", err)
+		return report, nil
+	}
+
+	// script
+	scriptDir := filepath.Clean(appConf.Game.ScriptConfig.LoadDir)
+	if !pkgFsys.ExistDir(scriptDir) {
+		report.addError(scriptDir, "script directory not found")
+	} else {
+		entryPattern := filepath.Join(scriptDir, appConf.Game.ScriptConfig.LoadPattern)
+		if matches, err := pkgFsys.Glob(entryPattern); err != nil || matches.Len() == 0 {
+			report.addError(entryPattern, "entry script not found")
+		}
+		report.ScriptCount = validatePackageFiles(pkgFsys, scriptDir, scriptFileExt, report)
+	}
+
+	// csv
+	csvDir := filepath.Clean(appConf.Game.CSVConfig.Dir)
+	if !pkgFsys.ExistDir(csvDir) {
+		report.addError(csvDir, "CSV directory not found")
+	} else {
+		report.CSVCount = validatePackageFiles(pkgFsys, csvDir, csvFileExt, report)
+		if report.CSVCount == 0 {
+			report.addWarning(csvDir, "no CSV files found")
+		}
+	}
+
+	// save
+	if saveDir := filepath.Clean(appConf.Game.RepoConfig.SaveFileDir); !pkgFsys.ExistDir(saveDir) {
+		report.addWarning(saveDir, "save directory not found, it will be created at first save")
+	}
+	return report, nil
+}
+
+// validatePackageFiles inspects files having ext under dir and returns number of the files.
+func validatePackageFiles(pkgFsys *WebFileSystem, dir string, ext string, report *PackageReport) int {
+	files, err := pkgFsys.WalkFiles(dir)
+	if err != nil {
+		report.addError(dir, "failed to list files: %v", err)
+		return 0
+	}
+	count := 0
+	for _, file := range files {
+		if !strings.EqualFold(filepath.Ext(file), ext) {
+			continue
+		}
+		count += 1
+		content, err := readAllFile(pkgFsys, file)
+		if err != nil {
+			report.addError(file, "failed to read: %v", err)
+			continue
+		}
+		if len(content) == 0 {
+			report.addWarning(file, "empty file")
+			continue
+		}
+		if !utf8.Valid(content) {
+			report.addError(file, "not UTF-8 encoded, Shift-JIS or other legacy encodings are not supported")
+		}
+	}
+	return count
+}